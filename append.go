@@ -0,0 +1,104 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// appendTailSize is the number of bytes at the end of a file searched for the
+// closing tags of the top-level array.
+const appendTailSize = 4096
+
+var (
+	arrayTail      = regexp.MustCompile(`\s*</array>\s*</plist>(\s*)$`)
+	emptyArrayTail = regexp.MustCompile(`<array\s*/>\s*</plist>(\s*)$`)
+)
+
+// AppendArrayFile appends values to the top-level array of the XML plist
+// stored in the file name. Only the closing tags at the end of the file are
+// rewritten, the existing elements are neither read nor rewritten. The
+// appended elements are indented like Value.Write indents array elements.
+func AppendArrayFile(name string, values ...Value) error {
+	file, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := appendArray(file, values); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// appendFile is the part of *os.File appendArray uses.
+type appendFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Name() string
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+}
+
+// appendArray writes the new tail of the file over the closing tags and only
+// then truncates the file to its end, so the file keeps ending in closing
+// tags unless the write fails part way.
+func appendArray(file appendFile, values []Value) error {
+	options := &WriteOptions{}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := options.checkValue(value, nil); err != nil {
+			return err
+		}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	start := info.Size() - appendTailSize
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]byte, info.Size()-start)
+	if _, err := file.ReadAt(tail, start); err != nil {
+		return err
+	}
+
+	var offset int64
+	var trailer []byte
+	var buffer bytes.Buffer
+	if match := arrayTail.FindSubmatchIndex(tail); match != nil {
+		offset = start + int64(match[0])
+		trailer = tail[match[2]:match[3]]
+	} else if match := emptyArrayTail.FindSubmatchIndex(tail); match != nil {
+		offset = start + int64(match[0])
+		trailer = tail[match[2]:match[3]]
+		// Replace the self-closing element with its opening tag.
+		buffer.WriteString("<array>")
+	} else {
+		return fmt.Errorf("%s does not end with a top-level array", file.Name())
+	}
+
+	writer := bufio.NewWriter(&buffer)
+	xmlWriter := newXmlWriter(writer, options)
+	xmlWriter.depth = 2
+	for _, value := range values {
+		if err := xmlWriter.writeValue(value); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(writer, "\n  </array>\n</plist>%s", trailer)
+	writer.Flush()
+	if _, err := file.WriteAt(buffer.Bytes(), offset); err != nil {
+		return err
+	}
+	return file.Truncate(offset + int64(buffer.Len()))
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func appendRecord(i int64) plist.Value {
+	return plist.Value{Value: map[string]plist.Value{
+		"id":   {Value: i, Type: plist.IntegerType},
+		"tags": {Value: []plist.Value{{Value: "log", Type: plist.StringType}}, Type: plist.ArrayType},
+	}, Type: plist.DictType}
+}
+
+func writeFile(t *testing.T, name string, value plist.Value) {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := value.Write(&buffer); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	buffer.WriteString("\n")
+	if err := os.WriteFile(name, buffer.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendArrayFile(t *testing.T) {
+	for _, initial := range [][]plist.Value{{}, {appendRecord(0)}} {
+		name := filepath.Join(t.TempDir(), "log.plist")
+		writeFile(t, name, plist.Value{Value: initial, Type: plist.ArrayType})
+		if err := plist.AppendArrayFile(name, appendRecord(1)); err != nil {
+			t.Fatalf("AppendArrayFile failed: %s", err)
+		}
+		if err := plist.AppendArrayFile(name, appendRecord(2), appendRecord(3)); err != nil {
+			t.Fatalf("AppendArrayFile failed: %s", err)
+		}
+
+		all := append(initial, appendRecord(1), appendRecord(2), appendRecord(3))
+		expectedName := filepath.Join(t.TempDir(), "expected.plist")
+		writeFile(t, expectedName, plist.Value{Value: all, Type: plist.ArrayType})
+		got, _ := os.ReadFile(name)
+		expected, _ := os.ReadFile(expectedName)
+		if !bytes.Equal(got, expected) {
+			t.Errorf("appended file differs from a complete write:\n%s\n%s", got, expected)
+		}
+	}
+}
+
+func TestAppendArrayFileSelfClosing(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log.plist")
+	os.WriteFile(name, []byte(`<plist version="1.0"><array/></plist>`), 0600)
+	if err := plist.AppendArrayFile(name, appendRecord(1)); err != nil {
+		t.Fatalf("AppendArrayFile failed: %s", err)
+	}
+	data, _ := os.ReadFile(name)
+	value := mustRead(t, string(data))
+	if items := value.Value.([]plist.Value); len(items) != 1 {
+		t.Errorf("unexpected array %v", value.Raw())
+	}
+}
+
+func TestAppendArrayFileRejectsDict(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dict.plist")
+	writeFile(t, name, appendRecord(0))
+	if err := plist.AppendArrayFile(name, appendRecord(1)); err == nil {
+		t.Errorf("expected an error for a dict root")
+	}
+}
+
+// fullFile is a file on a full disk: nothing can be written to it.
+type fullFile struct {
+	*os.File
+}
+
+func (self fullFile) WriteAt(p []byte, offset int64) (int, error) {
+	return 0, syscall.ENOSPC
+}
+
+func TestAppendArrayFileWriteError(t *testing.T) {
+	for _, initial := range []string{
+		"<plist version=\"1.0\">\n<array>\n  <true/>\n</array>\n</plist>\n",
+		`<plist version="1.0"><array/></plist>`,
+	} {
+		name := filepath.Join(t.TempDir(), "log.plist")
+		os.WriteFile(name, []byte(initial), 0600)
+		file, err := os.OpenFile(name, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plist.AppendArray(fullFile{file}, []plist.Value{appendRecord(1)}); !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("unexpected error %v", err)
+		}
+		file.Close()
+		if data, _ := os.ReadFile(name); string(data) != initial {
+			t.Errorf("file changed by a failed append:\n%s", data)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import "time"
+
+// DictBuilder builds a dict value with chained calls, e.g.
+//
+//	NewDictBuilder().String("Name", "demo").Int("Version", 2).Build()
+//
+// Setting a key again replaces its value.
+type DictBuilder struct {
+	entries map[string]Value
+}
+
+// ArrayBuilder builds an array value with chained calls, see DictBuilder.
+type ArrayBuilder struct {
+	values []Value
+}
+
+// NewDictBuilder returns a builder of an empty dict.
+func NewDictBuilder() *DictBuilder {
+	return &DictBuilder{entries: map[string]Value{}}
+}
+
+// NewArrayBuilder returns a builder of an empty array.
+func NewArrayBuilder() *ArrayBuilder {
+	return &ArrayBuilder{values: []Value{}}
+}
+
+// Value sets key to value.
+func (self *DictBuilder) Value(key string, value Value) *DictBuilder {
+	self.entries[key] = value
+	return self
+}
+
+// String sets key to a string.
+func (self *DictBuilder) String(key, value string) *DictBuilder {
+	return self.Value(key, Value{value, StringType})
+}
+
+// Int sets key to an integer.
+func (self *DictBuilder) Int(key string, value int64) *DictBuilder {
+	return self.Value(key, Value{value, IntegerType})
+}
+
+// Real sets key to a real.
+func (self *DictBuilder) Real(key string, value float64) *DictBuilder {
+	return self.Value(key, Value{value, RealType})
+}
+
+// Bool sets key to a boolean.
+func (self *DictBuilder) Bool(key string, value bool) *DictBuilder {
+	return self.Value(key, Value{value, BooleanType})
+}
+
+// Date sets key to a date.
+func (self *DictBuilder) Date(key string, value time.Time) *DictBuilder {
+	return self.Value(key, Value{value, DateType})
+}
+
+// Data sets key to a data value.
+func (self *DictBuilder) Data(key string, value []byte) *DictBuilder {
+	return self.Value(key, Value{value, DataType})
+}
+
+// Dict sets key to a dict filled by build.
+func (self *DictBuilder) Dict(key string, build func(*DictBuilder)) *DictBuilder {
+	nested := NewDictBuilder()
+	build(nested)
+	return self.Value(key, nested.Build())
+}
+
+// Array sets key to an array filled by build.
+func (self *DictBuilder) Array(key string, build func(*ArrayBuilder)) *DictBuilder {
+	nested := NewArrayBuilder()
+	build(nested)
+	return self.Value(key, nested.Build())
+}
+
+// Build returns the dict. It shares its map with the builder, so further
+// calls modify it.
+func (self *DictBuilder) Build() Value {
+	return Value{self.entries, DictType}
+}
+
+// Value appends value.
+func (self *ArrayBuilder) Value(value Value) *ArrayBuilder {
+	self.values = append(self.values, value)
+	return self
+}
+
+// String appends a string.
+func (self *ArrayBuilder) String(value string) *ArrayBuilder {
+	return self.Value(Value{value, StringType})
+}
+
+// Int appends an integer.
+func (self *ArrayBuilder) Int(value int64) *ArrayBuilder {
+	return self.Value(Value{value, IntegerType})
+}
+
+// Real appends a real.
+func (self *ArrayBuilder) Real(value float64) *ArrayBuilder {
+	return self.Value(Value{value, RealType})
+}
+
+// Bool appends a boolean.
+func (self *ArrayBuilder) Bool(value bool) *ArrayBuilder {
+	return self.Value(Value{value, BooleanType})
+}
+
+// Date appends a date.
+func (self *ArrayBuilder) Date(value time.Time) *ArrayBuilder {
+	return self.Value(Value{value, DateType})
+}
+
+// Data appends a data value.
+func (self *ArrayBuilder) Data(value []byte) *ArrayBuilder {
+	return self.Value(Value{value, DataType})
+}
+
+// Dict appends a dict filled by build.
+func (self *ArrayBuilder) Dict(build func(*DictBuilder)) *ArrayBuilder {
+	nested := NewDictBuilder()
+	build(nested)
+	return self.Value(nested.Build())
+}
+
+// Array appends an array filled by build.
+func (self *ArrayBuilder) Array(build func(*ArrayBuilder)) *ArrayBuilder {
+	nested := NewArrayBuilder()
+	build(nested)
+	return self.Value(nested.Build())
+}
+
+// Build returns the array. Elements appended later are not part of it.
+func (self *ArrayBuilder) Build() Value {
+	return Value{self.values[:len(self.values):len(self.values)], ArrayType}
+}
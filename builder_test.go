@@ -0,0 +1,55 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestBuilders(t *testing.T) {
+	date := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	value := plist.NewDictBuilder().
+		String("Name", "demo").
+		Int("Version", 2).
+		Real("Ratio", 0.5).
+		Bool("Enabled", true).
+		Date("Created", date).
+		Data("Icon", []byte("hi")).
+		Dict("Limits", func(d *plist.DictBuilder) {
+			d.Int("files", 100)
+		}).
+		Array("Items", func(a *plist.ArrayBuilder) {
+			a.String("a").Int(1).Real(1.5).Bool(false).Date(date).Data(nil).
+				Dict(func(d *plist.DictBuilder) {}).
+				Array(func(a *plist.ArrayBuilder) { a.Value(plist.NullValue) })
+		}).
+		Build()
+	expected := map[string]interface{}{
+		"Name":    "demo",
+		"Version": 2,
+		"Ratio":   0.5,
+		"Enabled": true,
+		"Created": date,
+		"Icon":    []byte("hi"),
+		"Limits":  map[string]interface{}{"files": 100},
+		"Items": []interface{}{
+			"a", 1, 1.5, false, date, []byte(nil),
+			map[string]interface{}{},
+			[]interface{}{nil},
+		},
+	}
+	if !value.EqualRaw(expected) {
+		t.Errorf("unexpected value %v", value.Raw())
+	}
+
+	builder := plist.NewArrayBuilder().Int(1)
+	array := builder.Build()
+	builder.Int(2)
+	if len(array.Array()) != 1 {
+		t.Errorf("built array changed by a later call: %v", array.Raw())
+	}
+}
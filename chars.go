@@ -0,0 +1,89 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// InvalidCharPolicy selects how strings and dict keys holding characters XML
+// cannot represent, like the control characters U+0000 to U+0008, are written.
+type InvalidCharPolicy int
+
+const (
+	// RejectInvalidChars fails with an *InvalidCharError before anything is
+	// written.
+	RejectInvalidChars InvalidCharPolicy = iota
+	// StripInvalidChars drops the characters.
+	StripInvalidChars
+	// ReplaceInvalidChars writes U+FFFD in place of each character.
+	ReplaceInvalidChars
+)
+
+// InvalidCharError reports a character XML cannot represent in a string or
+// dict key. Invalid UTF-8 is reported as utf8.RuneError.
+type InvalidCharError struct {
+	// Path is the key path of the string, or of the value of the key.
+	Path string
+	// Key is set when the character was found in a dict key.
+	Key  bool
+	Char rune
+}
+
+func (self *InvalidCharError) Error() string {
+	what := "string"
+	if self.Key {
+		what = "key"
+	}
+	return fmt.Sprintf("Invalid character %U in %s at %q", self.Char, what, self.Path)
+}
+
+// isXMLChar reports whether r matches the Char production of XML 1.0.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= utf8.MaxRune
+}
+
+// validRune reports whether r, decoded from the start of s, is not the
+// utf8.RuneError of invalid UTF-8.
+func validRune(s string, r rune) bool {
+	if r != utf8.RuneError {
+		return true
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return size > 1
+}
+
+// invalidChar returns the first character of s which XML cannot represent.
+func invalidChar(s string) (rune, bool) {
+	for i, r := range s {
+		if !isXMLChar(r) || !validRune(s[i:], r) {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// cleanText applies the InvalidChars policy to s.
+func (self *WriteOptions) cleanText(s string) string {
+	if self.InvalidChars == RejectInvalidChars {
+		return s
+	}
+	if _, ok := invalidChar(s); !ok {
+		return s
+	}
+	var builder strings.Builder
+	for i, r := range s {
+		if isXMLChar(r) && validRune(s[i:], r) {
+			builder.WriteRune(r)
+		} else if self.InvalidChars == ReplaceInvalidChars {
+			builder.WriteRune(utf8.RuneError)
+		}
+	}
+	return builder.String()
+}
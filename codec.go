@@ -0,0 +1,538 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	valueReflectType           = reflect.TypeOf(Value{})
+	timeReflectType            = reflect.TypeOf(time.Time{})
+	uidReflectType             = reflect.TypeOf(UID(0))
+	textMarshalerReflectType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerReflectType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Marshal returns the plist document of v in format, applying the conversions
+// of Value.Unmarshal in reverse.
+//
+// The functions Marshal and Unmarshal and the struct tags follow
+// howett.net/plist, so code using that package can switch its import path.
+// The tag of a field holds the dict key, optionally followed by
+// ",omitempty" to leave out zero values. Fields tagged "-" are skipped and
+// embedded structs without a tag contribute their fields to the dict.
+// Types implementing encoding.TextMarshaler or encoding.TextUnmarshaler are
+// stored as strings. Nil pointers, interfaces, slices and maps are left out
+// of dicts and arrays, marshaling them as the root value fails. A field of an
+// embedded struct is hidden by a field with the same key at a shallower
+// level, or at the same level by an earlier field.
+//
+// The deviations from howett.net/plist are:
+//
+//   - Only XMLFormat is written. Unmarshal reads XML documents only and
+//     fails with ErrUnsupportedFormat for binary plists.
+//   - The Marshaler and Unmarshaler interfaces and MarshalIndent are not
+//     provided, use an Encoder to choose the layout.
+func Marshal(v interface{}, format Format) ([]byte, error) {
+	if format != XMLFormat {
+		return nil, fmt.Errorf("Unsupported format %d", format)
+	}
+	value, ok, err := marshal(reflect.ValueOf(v), nil)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("Cannot marshal nil %T", v)
+	}
+	return value.Bytes()
+}
+
+// Unmarshal parses the plist document in data and stores it in the Go value
+// v points to, see Value.Unmarshal. It returns the format of the document.
+func Unmarshal(data []byte, v interface{}) (Format, error) {
+	value, err := Parse(data)
+	if errors.Is(err, ErrUnsupportedFormat) {
+		return BinaryFormat, err
+	} else if err != nil {
+		return XMLFormat, err
+	}
+	return XMLFormat, value.Unmarshal(v)
+}
+
+// Unmarshal stores the value in the Go value v points to. Dicts are stored in
+// structs or maps with string keys, arrays in slices or arrays, and scalars
+// in Go values of a matching kind: integers in any integer or float type they
+// fit into, reals in floats, dates in time.Time and data in []byte or in byte
+// arrays of the same length. Fields of type Value receive the value unchanged,
+// interface{} fields its Raw form.
+//
+// Struct fields are matched to dict keys by name or by the name given in a
+// `plist:"name"` tag, fields tagged `plist:"-"` are skipped. Keys without a
+// matching field are ignored. Strings are stored in types implementing
+// encoding.TextUnmarshaler. Null values leave their target at its zero value.
+// Values of a type the Go value cannot hold fail with a *TypeMismatchError.
+func (self Value) Unmarshal(v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("Unmarshal requires a non-nil pointer, got %T", v)
+	}
+	return self.unmarshal(target.Elem(), nil)
+}
+
+// Decode reads the plist document in data and unmarshals it into a new T.
+func Decode[T any](data []byte) (T, error) {
+	var result T
+	value, err := Parse(data)
+	if err == nil {
+		err = value.Unmarshal(&result)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// TypeMismatchError reports a value which cannot be unmarshaled into the Go
+// value at its path.
+type TypeMismatchError struct {
+	// Path is the key path of the value, empty for the root value.
+	Path string
+	// Expected is the type of value the Go type holds, InvalidType for Go
+	// types no value can be unmarshaled into.
+	Expected ValueType
+	Got      ValueType
+	// Target is the Go type.
+	Target reflect.Type
+}
+
+func (self *TypeMismatchError) Error() string {
+	at := "root"
+	if self.Path != "" {
+		at = strconv.Quote(self.Path)
+	}
+	if self.Expected == InvalidType {
+		return fmt.Sprintf("Cannot unmarshal %s at %s into %s", self.Got.Name(), at, self.Target)
+	}
+	return fmt.Sprintf("Expected %s at %s for %s, got %s", self.Expected.Name(), at, self.Target, self.Got.Name())
+}
+
+// expectedType returns the type of value unmarshaled into values of type t.
+func expectedType(t reflect.Type) ValueType {
+	switch t {
+	case timeReflectType:
+		return DateType
+	case uidReflectType:
+		return UIDType
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return DictType
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return DictType
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return DataType
+		}
+		return ArrayType
+	case reflect.String:
+		return StringType
+	case reflect.Bool:
+		return BooleanType
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return IntegerType
+	case reflect.Float32, reflect.Float64:
+		return RealType
+	}
+	return InvalidType
+}
+
+func (self Value) mismatch(target reflect.Value, path []string) error {
+	return &TypeMismatchError{Path: joinPath(path), Expected: expectedType(target.Type()), Got: self.Type, Target: target.Type()}
+}
+
+func (self Value) unmarshal(target reflect.Value, path []string) error {
+	switch {
+	case target.Type() == valueReflectType:
+		target.Set(reflect.ValueOf(self))
+		return nil
+	case self.Type == NullType:
+		target.SetZero()
+		return nil
+	case target.Kind() == reflect.Pointer:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return self.unmarshal(target.Elem(), path)
+	case target.Kind() == reflect.Interface && target.NumMethod() == 0 && self.IsValid():
+		target.Set(reflect.ValueOf(self.Raw()))
+		return nil
+	case self.Type == StringType && target.Kind() != reflect.String && target.CanAddr() && target.Addr().Type().Implements(textUnmarshalerReflectType):
+		if err := target.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(self.Value.(string))); err != nil {
+			return fmt.Errorf("Cannot unmarshal string into %s at %q: %w", target.Type(), joinPath(path), err)
+		}
+		return nil
+	}
+	switch self.Type {
+	case StringType:
+		if target.Kind() != reflect.String {
+			return self.mismatch(target, path)
+		}
+		target.SetString(self.Value.(string))
+	case BooleanType:
+		if target.Kind() != reflect.Bool {
+			return self.mismatch(target, path)
+		}
+		target.SetBool(self.Value.(bool))
+	case IntegerType, UIDType:
+		return self.unmarshalInteger(target, path)
+	case RealType:
+		if target.Kind() != reflect.Float32 && target.Kind() != reflect.Float64 {
+			return self.mismatch(target, path)
+		}
+		target.SetFloat(self.Value.(float64))
+	case DateType:
+		if target.Type() != timeReflectType {
+			return self.mismatch(target, path)
+		}
+		target.Set(reflect.ValueOf(self.Value))
+	case DataType:
+		if target.Kind() != reflect.Slice && target.Kind() != reflect.Array || target.Type().Elem().Kind() != reflect.Uint8 {
+			return self.mismatch(target, path)
+		}
+		data := self.data()
+		if target.Kind() == reflect.Slice {
+			target.SetBytes(bytes.Clone(data))
+		} else if len(data) != target.Len() {
+			return fmt.Errorf("Cannot unmarshal %d bytes of data into %s at %q", len(data), target.Type(), joinPath(path))
+		} else {
+			for i, b := range data {
+				target.Index(i).SetUint(uint64(b))
+			}
+		}
+	case ArrayType:
+		return self.unmarshalArray(target, path)
+	case DictType:
+		switch target.Kind() {
+		case reflect.Struct:
+			return self.unmarshalStruct(target, path)
+		case reflect.Map:
+			return self.unmarshalMap(target, path)
+		}
+		return self.mismatch(target, path)
+	default:
+		return self.mismatch(target, path)
+	}
+	return nil
+}
+
+// unmarshalInteger stores integers and UIDs, reporting values which do not
+// fit into target.
+func (self Value) unmarshalInteger(target reflect.Value, path []string) error {
+	var i int64
+	var u uint64
+	var large bool
+	if self.Type == UIDType {
+		u = uint64(self.Value.(UID))
+		i, large = int64(u), u > 1<<63-1
+	} else {
+		i, u, large = self.integer()
+	}
+	if self.Type == UIDType && target.Type() != uidReflectType && target.Kind() != reflect.Uint64 {
+		return self.mismatch(target, path)
+	}
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if large || target.OverflowInt(i) {
+			return fmt.Errorf("Integer %s overflows %s at %q", self.formatInteger(10), target.Type(), joinPath(path))
+		}
+		target.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !large {
+			if i < 0 {
+				return fmt.Errorf("Integer %d overflows %s at %q", i, target.Type(), joinPath(path))
+			}
+			u = uint64(i)
+		}
+		if target.OverflowUint(u) {
+			return fmt.Errorf("Integer %d overflows %s at %q", u, target.Type(), joinPath(path))
+		}
+		target.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if large {
+			target.SetFloat(float64(u))
+		} else {
+			target.SetFloat(float64(i))
+		}
+	default:
+		return self.mismatch(target, path)
+	}
+	return nil
+}
+
+func (self Value) unmarshalArray(target reflect.Value, path []string) error {
+	values := self.Value.([]Value)
+	switch target.Kind() {
+	case reflect.Slice:
+		target.Set(reflect.MakeSlice(target.Type(), len(values), len(values)))
+	case reflect.Array:
+		if len(values) > target.Len() {
+			return fmt.Errorf("Array of %d values does not fit into %s at %q", len(values), target.Type(), joinPath(path))
+		}
+		target.SetZero()
+	default:
+		return self.mismatch(target, path)
+	}
+	for i, v := range values {
+		if err := v.unmarshal(target.Index(i), append(path, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self Value) unmarshalMap(target reflect.Value, path []string) error {
+	if target.Type().Key().Kind() != reflect.String {
+		return self.mismatch(target, path)
+	}
+	m := self.dictMap()
+	if target.IsNil() {
+		target.Set(reflect.MakeMapWithSize(target.Type(), len(m)))
+	}
+	element := target.Type().Elem()
+	for k, v := range m {
+		item := reflect.New(element).Elem()
+		if err := v.unmarshal(item, append(path, k)); err != nil {
+			return err
+		}
+		target.SetMapIndex(reflect.ValueOf(k).Convert(target.Type().Key()), item)
+	}
+	return nil
+}
+
+func (self Value) unmarshalStruct(target reflect.Value, path []string) error {
+	m := self.dictMap()
+	for _, field := range structFields(target.Type()) {
+		if v, ok := m[field.name]; ok {
+			fieldValue, ok := allocateField(target, field.index)
+			if !ok {
+				continue
+			}
+			if err := v.unmarshal(fieldValue, append(path, field.name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allocateField returns the field at index, allocating nil embedded structs
+// on the way. Fields behind nil pointers to unexported structs cannot be set.
+func allocateField(target reflect.Value, index []int) (reflect.Value, bool) {
+	for i, n := range index {
+		if i > 0 && target.Kind() == reflect.Pointer {
+			if target.IsNil() {
+				if !target.CanSet() {
+					return target, false
+				}
+				target.Set(reflect.New(target.Type().Elem()))
+			}
+			target = target.Elem()
+		}
+		target = target.Field(n)
+	}
+	return target, true
+}
+
+// structField describes the dict entry of a struct field.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields returns the fields of a struct type stored as dict entries,
+// including those of embedded structs without a tag.
+func structFields(structType reflect.Type) []structField {
+	var fields []structField
+	seen := map[string]bool{}
+	// visited prevents endless recursion through embedded pointers.
+	visited := map[reflect.Type]bool{structType: true}
+	// Fields of shallower levels override the fields of embedded structs.
+	level := []structField{{}}
+	for len(level) > 0 {
+		var next []structField
+		var found []structField
+		for _, parent := range level {
+			t := structType
+			if len(parent.index) > 0 {
+				t = structType.FieldByIndex(parent.index).Type
+				if t.Kind() == reflect.Pointer {
+					t = t.Elem()
+				}
+			}
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				index := append(parent.index[:len(parent.index):len(parent.index)], i)
+				tag, tagged := field.Tag.Lookup("plist")
+				name, options, _ := strings.Cut(tag, ",")
+				if tag == "-" {
+					continue
+				}
+				embedded := field.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if field.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+					if !visited[embedded] {
+						visited[embedded] = true
+						next = append(next, structField{index: index})
+					}
+					continue
+				}
+				if !field.IsExported() {
+					continue
+				}
+				if !tagged || name == "" {
+					name = field.Name
+				}
+				found = append(found, structField{name: name, index: index, omitEmpty: options == "omitempty"})
+			}
+		}
+		for _, field := range found {
+			if !seen[field.name] {
+				seen[field.name] = true
+				fields = append(fields, field)
+			}
+		}
+		level = next
+	}
+	return fields
+}
+
+// emptyValue reports whether v is left out for omitempty: false, zero
+// numbers, empty strings and containers, and nil pointers and interfaces.
+func emptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// marshal converts v into a Value. It returns false for nil pointers,
+// interfaces, slices and maps, which have no plist representation.
+func marshal(v reflect.Value, path []string) (Value, bool, error) {
+	if !v.IsValid() {
+		return InvalidValue, false, nil
+	}
+	switch v.Type() {
+	case valueReflectType:
+		return v.Interface().(Value), true, nil
+	case timeReflectType:
+		return Value{v.Interface().(time.Time), DateType}, true, nil
+	case uidReflectType:
+		return Value{v.Interface().(UID), UIDType}, true, nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return InvalidValue, false, nil
+		}
+	}
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		// Dates, UIDs and values keep their type behind pointers rather
+		// than being marshaled as text.
+		switch v.Elem().Type() {
+		case valueReflectType, timeReflectType, uidReflectType:
+			return marshal(v.Elem(), path)
+		}
+	}
+	if v.Type().Implements(textMarshalerReflectType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return InvalidValue, false, fmt.Errorf("Cannot marshal %s at %q: %w", v.Type(), joinPath(path), err)
+		}
+		return Value{string(text), StringType}, true, nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return marshal(v.Elem(), path)
+	case reflect.String:
+		return Value{v.String(), StringType}, true, nil
+	case reflect.Bool:
+		return Value{v.Bool(), BooleanType}, true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Value{v.Int(), IntegerType}, true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > 1<<63-1 {
+			return Value{u, IntegerType}, true, nil
+		}
+		return Value{int64(v.Uint()), IntegerType}, true, nil
+	case reflect.Float32, reflect.Float64:
+		return Value{v.Float(), RealType}, true, nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return Value{data, DataType}, true, nil
+		}
+		values := make([]Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			value, ok, err := marshal(v.Index(i), append(path, strconv.Itoa(len(values))))
+			if err != nil {
+				return InvalidValue, false, err
+			} else if ok {
+				values = append(values, value)
+			}
+		}
+		return Value{values, ArrayType}, true, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := make(map[string]Value, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			key := iter.Key().String()
+			value, ok, err := marshal(iter.Value(), append(path, key))
+			if err != nil {
+				return InvalidValue, false, err
+			} else if ok {
+				m[key] = value
+			}
+		}
+		return Value{m, DictType}, true, nil
+	case reflect.Struct:
+		m := map[string]Value{}
+		for _, field := range structFields(v.Type()) {
+			fieldValue, err := v.FieldByIndexErr(field.index)
+			if err != nil || field.omitEmpty && emptyValue(fieldValue) {
+				// Fields of nil embedded pointers are left out.
+				continue
+			}
+			value, ok, err := marshal(fieldValue, append(path, field.name))
+			if err != nil {
+				return InvalidValue, false, err
+			} else if ok {
+				m[field.name] = value
+			}
+		}
+		return Value{m, DictType}, true, nil
+	}
+	return InvalidValue, false, fmt.Errorf("Cannot marshal %s at %q", v.Type(), joinPath(path))
+}
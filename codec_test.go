@@ -0,0 +1,243 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinzenz/go-plist"
+)
+
+type appConfig struct {
+	Name     string
+	Version  int `plist:"CFBundleVersion"`
+	Ratio    float32
+	Enabled  *bool
+	Tags     []string
+	Limits   map[string]uint16
+	Created  time.Time
+	Icon     []byte
+	Extra    interface{}
+	Raw      plist.Value
+	Ignored  string `plist:"-"`
+	internal string
+}
+
+const appConfigDocument = `<plist version="1.0"><dict>
+	<key>Name</key><string>demo</string>
+	<key>CFBundleVersion</key><integer>42</integer>
+	<key>Ratio</key><integer>2</integer>
+	<key>Enabled</key><true/>
+	<key>Tags</key><array><string>a</string><string>b</string></array>
+	<key>Limits</key><dict><key>files</key><integer>100</integer></dict>
+	<key>Created</key><date>2016-01-02T03:04:05Z</date>
+	<key>Icon</key><data>aGk=</data>
+	<key>Extra</key><array><integer>1</integer></array>
+	<key>Raw</key><dict/>
+	<key>Ignored</key><string>x</string>
+	<key>internal</key><string>x</string>
+	<key>Unknown</key><string>x</string>
+</dict></plist>`
+
+func TestDecode(t *testing.T) {
+	config, err := plist.Decode[appConfig]([]byte(appConfigDocument))
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	enabled := true
+	expected := appConfig{
+		Name:    "demo",
+		Version: 42,
+		Ratio:   2,
+		Enabled: &enabled,
+		Tags:    []string{"a", "b"},
+		Limits:  map[string]uint16{"files": 100},
+		Created: time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+		Icon:    []byte("hi"),
+		Extra:   []interface{}{int64(1)},
+		Raw:     plist.Value{Value: map[string]plist.Value{}, Type: plist.DictType},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("unexpected result\n%#v\n%#v", config, expected)
+	}
+
+	if _, err := plist.Decode[appConfig]([]byte(`<plist><dict><key>Limits</key><dict><key>files</key><integer>70000</integer></dict></dict></plist>`)); err == nil || !strings.Contains(err.Error(), `"Limits.files"`) {
+		t.Errorf("expected an overflow error at Limits.files, got %v", err)
+	}
+	if _, err := plist.Decode[appConfig]([]byte(`<plist><dict><key>Tags</key><string>a</string></dict></plist>`)); err == nil {
+		t.Errorf("expected an error for a type mismatch")
+	}
+	if _, err := plist.Decode[appConfig]([]byte(`<plist><dict>`)); err == nil {
+		t.Errorf("expected an error for a truncated document")
+	}
+}
+
+func TestValueUnmarshal(t *testing.T) {
+	var numbers [3]int8
+	value := plist.Value{Value: []plist.Value{{Value: int64(-1), Type: plist.IntegerType}, plist.NullValue}, Type: plist.ArrayType}
+	if err := value.Unmarshal(&numbers); err != nil || numbers != [3]int8{-1, 0, 0} {
+		t.Errorf("unexpected result %v, %v", numbers, err)
+	}
+	var unsigned []uint
+	if err := value.Unmarshal(&unsigned); err == nil {
+		t.Errorf("expected an error for a negative unsigned integer")
+	}
+	if err := value.Unmarshal(numbers); err == nil {
+		t.Errorf("expected an error for a non-pointer")
+	}
+}
+
+type migratedVersion struct{ major, minor int }
+
+func (self migratedVersion) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d", self.major, self.minor)), nil
+}
+
+func (self *migratedVersion) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d.%d", &self.major, &self.minor)
+	return err
+}
+
+type migratedBase struct {
+	Identifier string `plist:"CFBundleIdentifier"`
+	Name       string
+}
+
+type migratedConfig struct {
+	migratedBase
+	Name     string          `plist:"CFBundleName"`
+	Version  migratedVersion `plist:"CFBundleShortVersionString"`
+	Count    int             `plist:",omitempty"`
+	Comment  string          `plist:"comment,omitempty"`
+	Children []string        `plist:"children,omitempty"`
+	Parent   *migratedConfig `plist:"parent"`
+	Skipped  bool            `plist:"-"`
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	config := migratedConfig{
+		migratedBase: migratedBase{Identifier: "com.example.demo", Name: "hidden"},
+		Name:         "Demo",
+		Version:      migratedVersion{1, 2},
+		Children:     []string{"a"},
+		Skipped:      true,
+	}
+	data, err := plist.Marshal(config, plist.XMLFormat)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	value, err := plist.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %s\n%s", err, data)
+	}
+	expected := map[string]interface{}{
+		"CFBundleIdentifier":         "com.example.demo",
+		"Name":                       "hidden",
+		"CFBundleName":               "Demo",
+		"CFBundleShortVersionString": "1.2",
+		"children":                   []interface{}{"a"},
+	}
+	if !value.EqualRaw(expected) {
+		t.Errorf("unexpected document\n%s", data)
+	}
+
+	var decoded migratedConfig
+	if format, err := plist.Unmarshal(data, &decoded); err != nil || format != plist.XMLFormat {
+		t.Fatalf("Unmarshal failed: %v, %v", format, err)
+	}
+	config.Skipped = false
+	if !reflect.DeepEqual(decoded, config) {
+		t.Errorf("unexpected result\n%#v\n%#v", decoded, config)
+	}
+
+	if _, err := plist.Marshal((*migratedConfig)(nil), plist.XMLFormat); err == nil {
+		t.Errorf("expected an error for a nil root value")
+	}
+	if _, err := plist.Marshal(config, plist.BinaryFormat); err == nil {
+		t.Errorf("expected an error for the binary format")
+	}
+	if _, err := plist.Marshal(map[int]string{1: "a"}, plist.XMLFormat); err == nil {
+		t.Errorf("expected an error for a map without string keys")
+	}
+}
+
+func TestMarshalDatePointer(t *testing.T) {
+	created := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	type document struct {
+		Created *time.Time
+		Any     interface{}
+	}
+	data, err := plist.Marshal(document{&created, &created}, plist.XMLFormat)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if strings.Count(string(data), "<date>2016-01-02T03:04:05Z</date>") != 2 {
+		t.Errorf("expected dates\n%s", data)
+	}
+	var decoded document
+	if _, err := plist.Unmarshal(data, &decoded); err != nil || decoded.Created == nil || !decoded.Created.Equal(created) || decoded.Any != created {
+		t.Errorf("unexpected result %v, %v", decoded, err)
+	}
+}
+
+func TestMarshalByteArray(t *testing.T) {
+	type document struct {
+		Magic [4]byte
+	}
+	data, err := plist.Marshal(document{[4]byte{1, 2, 3, 4}}, plist.XMLFormat)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	var decoded document
+	if _, err := plist.Unmarshal(data, &decoded); err != nil || decoded.Magic != [4]byte{1, 2, 3, 4} {
+		t.Errorf("unexpected result %v, %v\n%s", decoded, err, data)
+	}
+
+	var short struct {
+		Magic [2]byte
+	}
+	if _, err := plist.Unmarshal(data, &short); err == nil || !strings.Contains(err.Error(), "4 bytes") {
+		t.Errorf("expected a length error, got %v", err)
+	}
+	var mismatch *plist.TypeMismatchError
+	if _, err := plist.Unmarshal([]byte(`<plist><dict><key>Magic</key><true/></dict></plist>`), &short); !errors.As(err, &mismatch) || mismatch.Expected != plist.DataType {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestUnmarshalTypeMismatch(t *testing.T) {
+	for _, test := range []struct {
+		document string
+		path     string
+		expected plist.ValueType
+		got      plist.ValueType
+		message  string
+	}{
+		{`<plist><array/></plist>`, "", plist.DictType, plist.ArrayType, "Expected dict at root for plist_test.appConfig, got array"},
+		{`<plist><dict><key>Tags</key><string>a</string></dict></plist>`, "Tags", plist.ArrayType, plist.StringType, `Expected array at "Tags" for []string, got string`},
+		{`<plist><dict><key>Icon</key><true/></dict></plist>`, "Icon", plist.DataType, plist.BooleanType, `Expected data at "Icon" for []uint8, got boolean`},
+		{`<plist><dict><key>Limits</key><dict><key>files</key><real>1.5</real></dict></dict></plist>`, "Limits.files", plist.IntegerType, plist.RealType, `Expected integer at "Limits.files" for uint16, got real`},
+	} {
+		_, err := plist.Decode[appConfig]([]byte(test.document))
+		var mismatch *plist.TypeMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Errorf("expected a TypeMismatchError for %s, got %v", test.document, err)
+			continue
+		}
+		if mismatch.Path != test.path || mismatch.Expected != test.expected || mismatch.Got != test.got || err.Error() != test.message {
+			t.Errorf("unexpected error %#v: %s", mismatch, err)
+		}
+	}
+
+	var channel chan int
+	err := plist.Value{Value: "x", Type: plist.StringType}.Unmarshal(&channel)
+	if mismatch, ok := err.(*plist.TypeMismatchError); !ok || mismatch.Expected != plist.InvalidType {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+// Dict is a view of the entries of a DictType value with convenience
+// accessors. It shares the map of the value, so Set modifies the value.
+type Dict map[string]Value
+
+// Array is a view of the elements of an ArrayType value with convenience
+// accessors. It shares the slice of the value.
+type Array []Value
+
+// Dict returns the entries of a dict value, also when it is held as
+// *OrderedDict, or nil for other values.
+func (self Value) Dict() Dict {
+	if self.Type != DictType {
+		return nil
+	}
+	return Dict(self.dictMap())
+}
+
+// Array returns the elements of an array value, or nil for other values.
+func (self Value) Array() Array {
+	if self.Type != ArrayType {
+		return nil
+	}
+	return Array(self.Value.([]Value))
+}
+
+// Value returns a dict value holding the entries.
+func (self Dict) Value() Value {
+	return Value{map[string]Value(self), DictType}
+}
+
+// Has reports whether key is present.
+func (self Dict) Has(key string) bool {
+	_, ok := self[key]
+	return ok
+}
+
+// Set stores value under key. Keys added to the view of an *OrderedDict are
+// written after the original keys, see OrderedDict.
+func (self Dict) Set(key string, value Value) {
+	self[key] = value
+}
+
+// GetString returns the string stored under key. The result is false if key
+// is missing or not a string.
+func (self Dict) GetString(key string) (string, bool) {
+	return self[key].stringValue()
+}
+
+// GetInt returns the integer stored under key. The result is false if key is
+// missing, not an integer or exceeds int64.
+func (self Dict) GetInt(key string) (int64, bool) {
+	return self[key].int64Value()
+}
+
+// Value returns an array value holding the elements.
+func (self Array) Value() Value {
+	return Value{[]Value(self), ArrayType}
+}
+
+// GetString returns the string at index i. The result is false if i is out of
+// range or the element is not a string.
+func (self Array) GetString(i int) (string, bool) {
+	if i < 0 || i >= len(self) {
+		return "", false
+	}
+	return self[i].stringValue()
+}
+
+// GetInt returns the integer at index i. The result is false if i is out of
+// range, the element is not an integer or exceeds int64.
+func (self Array) GetInt(i int) (int64, bool) {
+	if i < 0 || i >= len(self) {
+		return 0, false
+	}
+	return self[i].int64Value()
+}
+
+func (self Value) stringValue() (string, bool) {
+	if self.Type != StringType {
+		return "", false
+	}
+	return self.Value.(string), true
+}
+
+func (self Value) int64Value() (int64, bool) {
+	if self.Type != IntegerType {
+		return 0, false
+	}
+	i, _, large := self.integer()
+	return i, !large
+}
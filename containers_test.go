@@ -0,0 +1,59 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestDict(t *testing.T) {
+	value := mustRead(t, `<plist><dict>
+		<key>name</key><string>example</string>
+		<key>count</key><integer>3</integer>
+	</dict></plist>`)
+	dict := value.Dict()
+	if name, ok := dict.GetString("name"); !ok || name != "example" {
+		t.Errorf("unexpected name %q, %v", name, ok)
+	}
+	if count, ok := dict.GetInt("count"); !ok || count != 3 {
+		t.Errorf("unexpected count %d, %v", count, ok)
+	}
+	if _, ok := dict.GetInt("name"); ok {
+		t.Errorf("expected no integer for a string")
+	}
+	if _, ok := dict.GetString("missing"); ok || dict.Has("missing") || !dict.Has("name") {
+		t.Errorf("unexpected result for a missing key")
+	}
+	dict.Set("flag", plist.Value{Value: true, Type: plist.BooleanType})
+	if !value.EqualRaw(map[string]interface{}{"name": "example", "count": 3, "flag": true}) {
+		t.Errorf("Set did not modify the value: %v", value.Raw())
+	}
+	if !dict.Value().Equal(value) {
+		t.Errorf("Dict.Value differs from the value")
+	}
+	if value.Array() != nil || plist.InvalidValue.Dict() != nil {
+		t.Errorf("expected nil views for other types")
+	}
+	if ordered := decodeOrdered(t, orderedDocument).Dict(); len(ordered) == 0 {
+		t.Errorf("expected a view of an ordered dict")
+	}
+}
+
+func TestArray(t *testing.T) {
+	array := mustRead(t, `<plist><array><string>a</string><integer>-1</integer></array></plist>`).Array()
+	if s, ok := array.GetString(0); !ok || s != "a" {
+		t.Errorf("unexpected element %q, %v", s, ok)
+	}
+	if i, ok := array.GetInt(1); !ok || i != -1 {
+		t.Errorf("unexpected element %d, %v", i, ok)
+	}
+	if _, ok := array.GetInt(2); ok {
+		t.Errorf("expected no element out of range")
+	}
+	if !array.Value().EqualRaw([]interface{}{"a", -1}) {
+		t.Errorf("unexpected value %v", array.Value().Raw())
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// sourceReader passes the input to the xml.Decoder, remembering the last two
+// bytes read, so a streamed data element can tell <data/> from <data>.
+type sourceReader struct {
+	*bufio.Reader
+	last [2]byte
+}
+
+func (self *sourceReader) ReadByte() (byte, error) {
+	b, err := self.Reader.ReadByte()
+	if err == nil {
+		self.last[0], self.last[1] = self.last[1], b
+	}
+	return b, err
+}
+
+func (self *Decoder) streamingData() bool {
+	return self.StreamDataAbove > 0 && self.StreamData != nil
+}
+
+// dataText reads the base64 text of a data element directly from the input,
+// without the whitespace and comments, up to the end tag. The xml.Decoder
+// reads the end tag afterwards.
+type dataText struct {
+	decoder *Decoder
+	// pad appends the '=' padding missing from the text of padded encodings.
+	pad bool
+	// count is the number of base64 characters read, padded is set once
+	// padding was read.
+	count  int
+	padded bool
+	// padding is the number of '=' left to append at the end of the text.
+	padding int
+	done    bool
+	// pending holds the rest of the replacement text of an entity.
+	pending []byte
+	// cdata is set within a CDATA section.
+	cdata bool
+}
+
+const (
+	cdataStart   = "<![CDATA["
+	cdataEnd     = "]]>"
+	commentStart = "<!--"
+	commentEnd   = "-->"
+)
+
+// readByte reads the next byte of the input, counting it as streamed.
+func (self *dataText) readByte() (byte, error) {
+	c, err := self.decoder.buffered.ReadByte()
+	if err == nil {
+		self.decoder.streamed++
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return c, err
+}
+
+// skipComment reads a comment up to and including its end.
+func (self *dataText) skipComment() error {
+	self.decoder.buffered.Discard(len(commentStart))
+	self.decoder.streamed += int64(len(commentStart))
+	var last [len(commentEnd)]byte
+	for {
+		c, err := self.readByte()
+		if err != nil {
+			return err
+		}
+		copy(last[:], last[1:])
+		last[len(last)-1] = c
+		if string(last[:]) == commentEnd {
+			return nil
+		}
+	}
+}
+
+// reference reads a character or entity reference after its '&' and
+// returns its replacement text. Only references to ASCII characters can be
+// part of base64 text, entities are looked up in DecodeOptions.Entity.
+func (self *dataText) reference() ([]byte, error) {
+	var name []byte
+	for len(name) < 64 {
+		c, err := self.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ';' {
+			break
+		}
+		name = append(name, c)
+	}
+	switch text := string(name); text {
+	case "amp":
+		return []byte{'&'}, nil
+	case "lt":
+		return []byte{'<'}, nil
+	case "gt":
+		return []byte{'>'}, nil
+	case "quot":
+		return []byte{'"'}, nil
+	case "apos":
+		return []byte{'\''}, nil
+	default:
+		if replacement, ok := self.decoder.Entity[text]; ok {
+			return []byte(replacement), nil
+		}
+		var r uint64
+		var err error
+		if len(text) > 2 && text[:2] == "#x" {
+			r, err = strconv.ParseUint(text[2:], 16, 8)
+		} else if len(text) > 1 && text[0] == '#' {
+			r, err = strconv.ParseUint(text[1:], 10, 8)
+		} else {
+			err = fmt.Errorf("Unknown reference")
+		}
+		if err != nil || r >= 0x80 {
+			return nil, fmt.Errorf("Invalid reference &%s; in streamed data", text)
+		}
+		return []byte{byte(r)}, nil
+	}
+}
+
+// next returns the next character of the text, or end set at the end tag.
+func (self *dataText) next() (c byte, end bool, err error) {
+	buffered := self.decoder.buffered
+	for {
+		if len(self.pending) > 0 {
+			c, self.pending = self.pending[0], self.pending[1:]
+			return c, false, nil
+		}
+		if self.cdata {
+			if next, _ := buffered.Peek(len(cdataEnd)); string(next) == cdataEnd {
+				buffered.Discard(len(cdataEnd))
+				self.decoder.streamed += int64(len(cdataEnd))
+				self.cdata = false
+				continue
+			}
+			c, err := self.readByte()
+			return c, false, err
+		}
+		next, _ := buffered.Peek(len(cdataStart))
+		switch {
+		case bytes.HasPrefix(next, []byte("</")):
+			return 0, true, nil
+		case bytes.HasPrefix(next, []byte(commentStart)):
+			if err := self.skipComment(); err != nil {
+				return 0, false, err
+			}
+			continue
+		case string(next) == cdataStart:
+			buffered.Discard(len(cdataStart))
+			self.decoder.streamed += int64(len(cdataStart))
+			self.cdata = true
+			continue
+		case len(next) > 0 && next[0] == '<':
+			return 0, false, fmt.Errorf("Unexpected markup in streamed data")
+		}
+		if c, err = self.readByte(); err != nil || c != '&' {
+			return c, false, err
+		}
+		if self.pending, err = self.reference(); err != nil {
+			return 0, false, err
+		}
+	}
+}
+
+func (self *dataText) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if self.done {
+			if self.padding == 0 {
+				if n == 0 {
+					return 0, io.EOF
+				}
+				break
+			}
+			p[n] = '='
+			n++
+			self.padding--
+			continue
+		}
+		c, end, err := self.next()
+		if err != nil {
+			return n, err
+		} else if end {
+			// Leave the end tag to the xml.Decoder.
+			self.done = true
+			if self.pad && !self.padded && self.count%4 != 0 {
+				self.padding = 4 - self.count%4
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r', '\f', '\v':
+			continue
+		case '=':
+			self.padded = true
+		}
+		p[n] = c
+		n++
+		self.count++
+	}
+	return n, nil
+}
+
+// streamData reads a data element which may be streamed to StreamData. Its
+// text is read into memory up to StreamDataAbove bytes, shorter values are
+// decoded as usual.
+func (self *Decoder) streamData(element xml.StartElement) (Value, error) {
+	if self.source.last == [2]byte{'/', '>'} {
+		// An empty-element tag.
+		return self.elementDecoder(element)(self.scalarFilter("data"))
+	}
+	encoding := self.dataEncoding()
+	text := &dataText{decoder: self, pad: encoding.EncodedLen(1) == 4}
+	var head bytes.Buffer
+	n, err := io.CopyN(&head, text, int64(self.StreamDataAbove)+1)
+	if err != nil && err != io.EOF {
+		return InvalidValue, plistErrorFromError(self.inputOffset(), err)
+	}
+	var value Value
+	if n <= int64(self.StreamDataAbove) {
+		value, err = self.scalarFilter("data")(head.String())
+	} else {
+		data := base64.NewDecoder(encoding, io.MultiReader(&head, text))
+		if value, err = self.StreamData(joinPath(self.path), data); err == nil {
+			_, err = io.Copy(io.Discard, data)
+		}
+	}
+	if err != nil {
+		return InvalidValue, withOffset(self.inputOffset(), err)
+	}
+	if _, err := self.decoder.Token(); err != nil {
+		return InvalidValue, plistErrorFromError(self.inputOffset(), err)
+	}
+	return value, nil
+}
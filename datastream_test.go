@@ -0,0 +1,203 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+// patternReader produces n bytes of a repeating pattern.
+type patternReader struct{ n, offset int }
+
+func (self *patternReader) Read(p []byte) (int, error) {
+	if self.offset >= self.n {
+		return 0, io.EOF
+	}
+	p = p[:min(len(p), self.n-self.offset)]
+	for i := range p {
+		p[i] = byte((self.offset + i) * 31 / 7)
+	}
+	self.offset += len(p)
+	return len(p), nil
+}
+
+// wrappedBase64 writes the base64 text of its input in indented lines.
+type wrappedBase64 struct {
+	writer *bufio.Writer
+	column int
+}
+
+func (self *wrappedBase64) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if self.column%64 == 0 {
+			self.writer.WriteString("\n\t\t")
+		}
+		self.writer.WriteByte(c)
+		self.column++
+	}
+	return len(p), nil
+}
+
+// largeDataDocument returns a reader producing a document holding a data
+// value of size bytes without keeping the document in memory.
+func largeDataDocument(size int) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		buffered := bufio.NewWriter(writer)
+		buffered.WriteString("<plist version=\"1.0\">\n<dict>\n\t<key>firmware</key>\n\t<data>")
+		encoder := base64.NewEncoder(base64.StdEncoding, &wrappedBase64{writer: buffered})
+		io.Copy(encoder, &patternReader{n: size})
+		encoder.Close()
+		buffered.WriteString("\n\t</data>\n\t<key>after</key>\n\t<string>x</string>\n</dict>\n</plist>\n")
+		buffered.Flush()
+		writer.Close()
+	}()
+	return reader
+}
+
+func TestStreamData(t *testing.T) {
+	const size = 32 << 20
+	expected := sha256.New()
+	io.Copy(expected, &patternReader{n: size})
+
+	decoder := plist.NewDecoder(largeDataDocument(size))
+	decoder.StreamDataAbove = 1 << 20
+	var paths []string
+	digest := sha256.New()
+	decoder.StreamData = func(path string, data io.Reader) (plist.Value, error) {
+		paths = append(paths, path)
+		n, err := io.Copy(digest, data)
+		return plist.Value{Value: n, Type: plist.IntegerType}, err
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	value, err := decoder.Decode()
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if !value.EqualRaw(map[string]interface{}{"firmware": int64(size), "after": "x"}) {
+		t.Errorf("unexpected value %v", value.Raw())
+	}
+	if len(paths) != 1 || paths[0] != "firmware" || !bytes.Equal(digest.Sum(nil), expected.Sum(nil)) {
+		t.Errorf("unexpected streamed data at %v", paths)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("allocated %d bytes while streaming %d bytes", allocated, size)
+
+	}
+}
+
+func TestStreamDataSmallValues(t *testing.T) {
+	const document = `<plist><array>
+		<data>aGVs
+		bG8=</data>
+		<data/>
+		<data></data>
+		<data>aGVsbG8gd29y&#13;&#x0A;bGQ</data>
+		<data>aGVsbG8gd29ybGQgYWdhaW4=</data>
+		<string>end</string>
+	</array></plist>`
+	decoder := plist.NewDecoder(strings.NewReader(document))
+	decoder.StreamDataAbove = 16
+	streamed := map[string]string{}
+	decoder.StreamData = func(path string, data io.Reader) (plist.Value, error) {
+		b, err := io.ReadAll(data)
+		streamed[path] = string(b)
+		return plist.Value{Value: "streamed", Type: plist.StringType}, err
+	}
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if !value.EqualRaw([]interface{}{[]byte("hello"), []byte{}, []byte{}, []byte("hello world"), "streamed", "end"}) {
+		t.Errorf("unexpected value %v", value.Raw())
+	}
+	if len(streamed) != 1 || streamed["4"] != "hello world again" {
+		t.Errorf("unexpected streamed values %q", streamed)
+	}
+}
+
+func TestStreamDataMarkup(t *testing.T) {
+	// Small values are held in memory, larger ones streamed, both may hold
+	// comments, CDATA sections and entity references.
+	for _, text := range []string{
+		"aGVs<!-- x -->bG8=",
+		"<![CDATA[aGVsbG8=]]>",
+		"aGVs&rest;",
+		"aGVsbG8gd29y<!-- comment -->bGQgYWdhaW4=",
+		"<![CDATA[aGVsbG8gd29y]]>\n<![CDATA[bGQgYWdhaW4=]]>",
+		"aGVsbG8gd29y&again;",
+	} {
+		decoder := plist.NewDecoder(strings.NewReader("<plist><array><data>" + text + "</data><true/></array></plist>"))
+		decoder.Entity = map[string]string{"rest": "bG8=", "again": "bGQg\nYWdhaW4="}
+		decoder.StreamDataAbove = 16
+		var streamed []byte
+		decoder.StreamData = func(path string, data io.Reader) (plist.Value, error) {
+			b, err := io.ReadAll(data)
+			streamed = b
+			return plist.Value{Value: b, Type: plist.DataType}, err
+		}
+		value, err := decoder.Decode()
+		if err != nil {
+			t.Errorf("unexpected error %v for %q", err, text)
+			continue
+		}
+		data, _ := value.Value.([]plist.Value)[0].Data()
+		if string(data) != "hello" && string(data) != "hello world again" {
+			t.Errorf("unexpected data %q for %q", data, text)
+		}
+		if (streamed != nil) != (len(data) > 5) {
+			t.Errorf("unexpected streaming of %q", text)
+		}
+	}
+}
+
+func TestStreamDataErrors(t *testing.T) {
+	handler := func(path string, data io.Reader) (plist.Value, error) {
+		return plist.NullValue, nil
+	}
+	failing := errors.New("disk full")
+	for _, test := range []struct {
+		document string
+		handler  func(string, io.Reader) (plist.Value, error)
+		message  string
+	}{
+		{`<plist><data>aGVsbG8gd29ybGQ<?x?>=</data></plist>`, handler, "Unexpected markup"},
+		{`<plist><data>aGVsbG8gd29ybGQ&unknown;</data></plist>`, handler, "Invalid reference"},
+		{`<plist><data>aGVsbG8gd29ybGQ<!-- x </data></plist>`, handler, "Truncated"},
+		{`<plist><data>aGVsbG8gd29ybGQ*</data></plist>`, handler, "illegal base64 data"},
+		{`<plist><data>aGVsbG8gd29ybGQ&#xE9;</data></plist>`, handler, "Invalid reference"},
+		{`<plist><data>aGVsbG8gd29ybGQ`, handler, "Truncated"},
+		{`<plist><data>aGVsbG8gd29ybGQ=</data></plist>`, func(string, io.Reader) (plist.Value, error) { return plist.NullValue, failing }, "disk full"},
+	} {
+		decoder := plist.NewDecoder(strings.NewReader(test.document))
+		decoder.StreamDataAbove = 8
+		decoder.StreamData = test.handler
+		if _, err := decoder.Decode(); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("expected an error containing %q for %s, got %v", test.message, test.document, err)
+		}
+	}
+
+	// Offsets after a streamed value count its text.
+	const document = `<plist><array><data>aGVsbG8gd29ybGQ=</data><integer>x</integer></array></plist>`
+	decoder := plist.NewDecoder(strings.NewReader(document))
+	decoder.StreamDataAbove = 8
+	decoder.StreamData = handler
+	offset := strings.Index(document, "</integer>") + len("</integer>")
+	if _, err := decoder.Decode(); err == nil || !strings.Contains(err.Error(), "line: "+strconv.Itoa(offset)+":") {
+		t.Errorf("expected an error at %d, got %v", offset, err)
+	}
+}
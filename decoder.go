@@ -0,0 +1,422 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// DecodeOptions control how plist documents are parsed.
+// The zero value reads documents the same way Read does.
+//
+// The size limits MaxDataBytes, MaxStringBytes, MaxCollectionElements and
+// MaxTotalValues fail with a *LimitError and default to unlimited. Set them
+// when reading untrusted input: the text of a value is held in memory while
+// it is parsed, so only the limits together with a limit on the input size,
+// e.g. io.LimitReader, bound the memory used.
+type DecodeOptions struct {
+	// Entity maps additional XML entity names to their replacement text,
+	// see xml.Decoder.Entity.
+	Entity map[string]string
+	// RelaxedXML disables the strict mode of the underlying xml.Decoder,
+	// see xml.Decoder.Strict. Unknown entities are then passed through as
+	// text and mismatched tags are tolerated where possible.
+	RelaxedXML bool
+	// MaxDataBytes limits the decoded size of a single data value. Documents
+	// containing larger data values are rejected before the value is
+	// allocated. Zero means no limit.
+	MaxDataBytes int
+	// MaxStringBytes limits the length of a single string or key in bytes.
+	MaxStringBytes int
+	// MaxCollectionElements limits the number of elements of a single array
+	// and of distinct keys of a single dict.
+	MaxCollectionElements int
+	// MaxTotalValues limits the number of values of a document, counting
+	// dicts, arrays and scalars but not keys.
+	MaxTotalValues int
+	// OrderedDicts decodes dicts as *OrderedDict instead of map[string]Value,
+	// remembering the original key order. Writing with KeySort set to
+	// PreserveSort then reproduces that order.
+	OrderedDicts bool
+	// PreserveNumberText records the original text of integers and reals in
+	// the Metadata of the document, e.g. "-2.0e+04" or "0x1F". Writing with
+	// that Metadata reproduces the text of every number which still holds
+	// its decoded value.
+	PreserveNumberText bool
+	// KeepAttributes records the attributes of the plist element and of all
+	// value elements in the Metadata of the document, so vendor specific
+	// attributes survive a round-trip. Attributes of key elements are not
+	// recorded.
+	KeepAttributes bool
+	// DecodeUIDs decodes dicts holding only a CF$UID integer, the XML form of
+	// NSKeyedArchiver object references, as UIDType values.
+	DecodeUIDs bool
+	// LenientData decodes data values which DataEncoding rejects with the
+	// URL-safe base64 alphabet, and failing that, with stray characters such
+	// as "*" or "." removed: anything but letters, digits and "+/-_=".
+	// Missing padding and whitespace are always tolerated.
+	LenientData bool
+	// LazyData keeps the base64 text of data values and decodes it only
+	// when the bytes are accessed. The text is still validated while
+	// reading. Writing the value copies the text unchanged when it uses the
+	// same DataEncoding, which avoids decoding and encoding data for
+	// documents that are read, changed and written back. Value.Value of such
+	// data values holds an internal type, use Value.Data or Value.Raw to
+	// access the bytes.
+	LazyData bool
+	// StreamDataAbove streams data values whose base64 text, without
+	// whitespace, is longer than this many bytes to StreamData instead of
+	// holding them in memory. Zero disables streaming. Streamed values are
+	// decoded with DataEncoding only. Their text may contain whitespace,
+	// comments, CDATA sections and references, entity references only to
+	// the predefined entities and those of Entity.
+	StreamDataAbove int
+	// StreamData receives the decoded bytes of each streamed data value
+	// together with its key path. Unread bytes are skipped when it returns.
+	// The Value returned replaces the data value, e.g. a string naming the
+	// file the bytes were saved to. MaxDataBytes does not apply.
+	StreamData func(path string, data io.Reader) (Value, error)
+	// StrictDates accepts dates in RFC 3339 format only, e.g.
+	// "2016-11-01T08:46:41.123Z". By default dates with offsets lacking a
+	// colon, "2016-11-01T08:46:41+0000", and in the GNUstep format,
+	// "2016-11-01 08:46:41 +0000", are accepted as well. The offset of the
+	// text is kept in the location of the date.
+	StrictDates bool
+	// LenientDates accepts two more shapes of dates, filling the missing
+	// parts with zeros: dates without seconds, "2016-11-01T08:46Z" or
+	// "2016-11-01T08:46+01:00", and dates without a time, "2016-11-01", at
+	// midnight UTC. It has no effect with StrictDates.
+	LenientDates bool
+	// DataEncoding decodes the text of data values, base64.StdEncoding by
+	// default. ASCII whitespace, including line breaks of any style, is
+	// ignored with any encoding.
+	DataEncoding *base64.Encoding
+	// KeyTransform replaces every dict key as it is read, e.g. with
+	// strings.ToLower. KeyCollisions selects what happens when different keys
+	// of a dict are transformed to the same key.
+	KeyTransform  func(string) string
+	KeyCollisions DuplicateKeyPolicy
+	// DuplicateKeys selects what happens when a dict holds the same key more
+	// than once, LastKeyWins by default. Dicts decoded as *OrderedDict keep
+	// the key at the position of its first occurrence.
+	DuplicateKeys DuplicateKeyPolicy
+	// BooleanPaths lists the key paths of booleans which may be stored as
+	// the integers 0 and 1, e.g. "Settings.Enabled". Such integers are
+	// decoded as BooleanType, other integers are kept.
+	BooleanPaths []string
+	// KeepEncoding records the encoding named in the XML declaration in the
+	// Metadata of the document, so it is declared again when writing.
+	KeepEncoding bool
+	// KeepComments records comments in the Metadata of the document, so they
+	// are written again. A comment belongs to the root value, dict entry or
+	// array element following it, comments between a key and its value
+	// belong to that entry. Comments after the last entry or element of a
+	// dict or array are kept as its trailing comment. Several comments are
+	// joined with line breaks. Comments outside the plist element, after
+	// the root value and within scalars are dropped.
+	KeepComments bool
+	// AllowDirectives accepts a DOCTYPE with an internal subset, e.g. one
+	// declaring entities, and other directives before the plist element.
+	// These are rejected by default, as the DOCTYPE of plists is fixed and
+	// entity declarations are the vehicle of expansion attacks.
+	AllowDirectives bool
+	// Prologue selects what else may precede the plist element,
+	// LenientPrologue by default.
+	Prologue PrologueMode
+	// MaxDepth limits how deep dicts and arrays may be nested. Deeper
+	// documents fail with an error wrapping ErrTooDeep. Zero means
+	// DefaultMaxDepth, a negative value no limit.
+	MaxDepth int
+}
+
+// DefaultMaxDepth is the nesting limit used when DecodeOptions.MaxDepth is
+// zero.
+const DefaultMaxDepth = 512
+
+// ErrTooDeep is wrapped by errors reporting dicts and arrays nested deeper
+// than DecodeOptions.MaxDepth, test for it with errors.Is.
+var ErrTooDeep = errors.New("Plist nested too deep")
+
+// DuplicateKeyPolicy selects how a dict key which is read more than once is
+// handled.
+type DuplicateKeyPolicy int
+
+const (
+	// LastKeyWins keeps the value of the last occurrence.
+	LastKeyWins DuplicateKeyPolicy = iota
+	// RejectDuplicateKeys fails with a *DuplicateKeyError.
+	RejectDuplicateKeys
+	// FirstKeyWins keeps the value of the first occurrence.
+	FirstKeyWins
+)
+
+// PrologueMode selects how content before the plist element is handled.
+// The XML declaration, whitespace and a DOCTYPE are always accepted, other
+// directives only with AllowDirectives.
+type PrologueMode int
+
+const (
+	// LenientPrologue skips comments, processing instructions and text, but
+	// rejects elements other than plist.
+	LenientPrologue PrologueMode = iota
+	// StrictPrologue rejects comments, processing instructions other than
+	// the XML declaration, text and elements other than plist.
+	StrictPrologue
+	// SkipUnknownElements skips comments, processing instructions, text and
+	// elements other than plist together with their content.
+	SkipUnknownElements
+)
+
+// DuplicateKeyError reports a key read more than once in a dict. It is
+// returned wrapped with the input offset, use errors.As to access it.
+type DuplicateKeyError struct {
+	// Path is the key path of the dict.
+	Path string
+	Key  string
+}
+
+func (self *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("Duplicate key %q in dict at %q", self.Key, self.Path)
+}
+
+// LimitError reports input exceeding one of the limits of DecodeOptions. It
+// is returned wrapped with the input offset, use errors.As to access it.
+type LimitError struct {
+	// Limit is the name of the option, e.g. "MaxStringBytes".
+	Limit string
+	Max   int
+}
+
+func (self *LimitError) Error() string {
+	return fmt.Sprintf("Input exceeds %s of %d", self.Limit, self.Max)
+}
+
+func (self *DecodeOptions) maxDepth() int {
+	switch {
+	case self.MaxDepth == 0:
+		return DefaultMaxDepth
+	case self.MaxDepth < 0:
+		return math.MaxInt
+	}
+	return self.MaxDepth
+}
+
+func (self *DecodeOptions) dataEncoding() *base64.Encoding {
+	if self.DataEncoding == nil {
+		return base64.StdEncoding
+	}
+	return self.DataEncoding
+}
+
+// Decoder reads plist documents from an input stream.
+// The options must be set before the first call to Decode.
+type Decoder struct {
+	DecodeOptions
+	reader   io.Reader
+	buffered *bufio.Reader
+	// source passes the input to decoder when data values are streamed.
+	source   *sourceReader
+	decoder  *xml.Decoder
+	metadata *Metadata
+	// path holds the key path segments of the value being decoded.
+	path []string
+	// prefixes maps namespace URLs to the prefixes declared for them.
+	prefixes map[string]string
+	// booleanPaths holds the paths of DecodeOptions.BooleanPaths.
+	booleanPaths map[string]bool
+	// depth is the number of open dicts and arrays.
+	depth int
+	// values is the number of values read from the document.
+	values int
+	// scratch is the buffer in which LazyData text is validated.
+	scratch []byte
+	// comments holds the comments read since the last value when
+	// KeepComments is set.
+	comments []string
+	// streamed is the number of bytes of streamed data values, which
+	// decoder did not read.
+	streamed int64
+}
+
+// NewDecoder returns a Decoder reading from reader with default options. The
+// Decoder buffers the input and may read ahead past the end of a document,
+// unless reader is a *bufio.Reader, which it reads from directly. Pass one
+// to read further data from reader after a document.
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{reader: reader}
+}
+
+func (self *Decoder) init() {
+	if self.decoder == nil {
+		// Buffering allows to look for the magic of binary plists.
+		if buffered, ok := self.reader.(*bufio.Reader); ok {
+			self.buffered = buffered
+		} else {
+			self.buffered = bufio.NewReader(self.reader)
+		}
+		if self.streamingData() {
+			self.source = &sourceReader{Reader: self.buffered}
+			self.decoder = xml.NewDecoder(self.source)
+		} else {
+			self.decoder = xml.NewDecoder(self.buffered)
+		}
+		self.decoder.CharsetReader = charsetReader
+		self.decoder.Entity = self.Entity
+		self.decoder.Strict = !self.RelaxedXML
+		if len(self.BooleanPaths) > 0 {
+			self.booleanPaths = make(map[string]bool, len(self.BooleanPaths))
+			for _, path := range self.BooleanPaths {
+				self.booleanPaths[path] = true
+			}
+		}
+	}
+}
+
+// Decode parses the next plist document from the input. Documents may follow
+// each other in the same stream, each with its own XML declaration and
+// DOCTYPE. io.EOF is returned when the input holds no further document.
+func (self *Decoder) Decode() (Value, error) {
+	self.init()
+	self.reset()
+	return self.readDocument()
+}
+
+// reset clears the state of the previous document.
+func (self *Decoder) reset() {
+	self.metadata = nil
+	if self.PreserveNumberText || self.KeepAttributes || self.KeepEncoding || self.KeepComments {
+		self.metadata = &Metadata{numbers: map[string]numberText{}, attributes: map[string][]xml.Attr{}, comments: map[string]string{}, trailing: map[string]string{}}
+	}
+	self.comments = self.comments[:0]
+	self.path = self.path[:0]
+	self.depth = 0
+	self.values = 0
+}
+
+// inputOffset returns the offset of the input read so far.
+func (self *Decoder) inputOffset() int64 {
+	return self.decoder.InputOffset() + self.streamed
+}
+
+// limitError returns a *LimitError for limit wrapped with the input offset.
+func (self *Decoder) limitError(limit string, max int) error {
+	return plistErrorFromError(self.inputOffset(), &LimitError{Limit: limit, Max: max})
+}
+
+// enter opens a dict or array, failing if that exceeds the nesting limit.
+// Each successful call must be paired with a call to leave.
+func (self *Decoder) enter() error {
+	if self.depth >= self.maxDepth() {
+		return plistErrorFromError(self.inputOffset(), fmt.Errorf("%w: more than %d levels", ErrTooDeep, self.maxDepth()))
+	}
+	self.depth++
+	return nil
+}
+
+func (self *Decoder) leave() {
+	self.depth--
+}
+
+// Metadata returns the details recorded while decoding the most recent
+// document, or nil when DecodeOptions requested no recording.
+func (self *Decoder) Metadata() *Metadata {
+	return self.metadata
+}
+
+// ReadAll parses all plist documents concatenated in reader.
+func ReadAll(reader io.Reader) ([]Value, error) {
+	decoder := NewDecoder(reader)
+	var values []Value
+	for {
+		value, err := decoder.Decode()
+		if err == io.EOF {
+			return values, nil
+		} else if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+}
+
+// recordAttributes stores the attributes of element at the current path when
+// requested by KeepAttributes. The attributes of the plist element are
+// stored separately.
+func (self *Decoder) recordAttributes(element xml.StartElement, plist bool) {
+	if self.metadata == nil || !self.KeepAttributes || len(element.Attr) == 0 {
+		return
+	}
+	for _, attr := range element.Attr {
+		if attr.Name.Space == "xmlns" {
+			if self.prefixes == nil {
+				self.prefixes = map[string]string{}
+			}
+			self.prefixes[attr.Value] = attr.Name.Local
+		}
+	}
+	attributes := make([]xml.Attr, len(element.Attr))
+	for i, attr := range element.Attr {
+		attributes[i] = xml.Attr{Name: xml.Name{Local: self.qualifiedName(attr.Name)}, Value: attr.Value}
+	}
+	if plist {
+		self.metadata.plist = attributes
+	} else {
+		self.metadata.attributes[joinPath(self.path)] = attributes
+	}
+}
+
+// recordDeclaration stores the encoding named by the XML declaration inst
+// when requested by KeepEncoding.
+func (self *Decoder) recordDeclaration(inst xml.ProcInst) {
+	if self.metadata != nil && self.KeepEncoding && inst.Target == "xml" {
+		self.metadata.encoding = declaredEncoding(string(inst.Inst))
+	}
+}
+
+// recordComment keeps comment for the next value when requested by
+// KeepComments.
+func (self *Decoder) recordComment(comment xml.Comment) {
+	if self.metadata != nil && self.KeepComments {
+		self.comments = append(self.comments, strings.TrimSpace(string(comment)))
+	}
+}
+
+// attachComments stores the comments kept for the value at the current path.
+func (self *Decoder) attachComments() {
+	if len(self.comments) > 0 {
+		self.metadata.comments[joinPath(self.path)] = strings.Join(self.comments, "\n")
+		self.comments = self.comments[:0]
+	}
+}
+
+// attachTrailingComments stores the comments kept at the end of the dict or
+// array at the current path.
+func (self *Decoder) attachTrailingComments() {
+	if len(self.comments) > 0 {
+		self.metadata.trailing[joinPath(self.path)] = strings.Join(self.comments, "\n")
+		self.comments = self.comments[:0]
+	}
+}
+
+// qualifiedName turns an attribute name translated by xml.Decoder back into
+// its prefixed form.
+func (self *Decoder) qualifiedName(name xml.Name) string {
+	switch name.Space {
+	case "":
+		return name.Local
+	case "xmlns":
+		return "xmlns:" + name.Local
+	}
+	if prefix, ok := self.prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	// Undeclared prefixes are not translated.
+	return name.Space + ":" + name.Local
+}
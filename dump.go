@@ -0,0 +1,141 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dumpDataBytes is the number of data bytes shown by Dump.
+const dumpDataBytes = 16
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorPurple = "\x1b[35m"
+	colorCyan   = "\x1b[36m"
+)
+
+var dumpColors = [typeCount]string{
+	StringType:  colorGreen,
+	IntegerType: colorCyan,
+	RealType:    colorCyan,
+	BooleanType: colorYellow,
+	DateType:    colorPurple,
+	DataType:    colorBlue,
+	UIDType:     colorCyan,
+}
+
+type dumper struct {
+	writer *bufio.Writer
+	color  bool
+}
+
+func (self *dumper) colored(color, s string) {
+	if self.color && color != "" {
+		self.writer.WriteString(color + s + colorReset)
+	} else {
+		self.writer.WriteString(s)
+	}
+}
+
+func (self *dumper) dump(value Value, depth int) {
+	indent := strings.Repeat(indentation, depth+1)
+	switch value.Type {
+	case DictType:
+		m := value.dictMap()
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		self.writer.WriteString("dict {\n")
+		for _, key := range keys {
+			self.writer.WriteString(indent)
+			self.colored(colorBold, strconv.Quote(key))
+			self.writer.WriteString(": ")
+			self.dump(m[key], depth+1)
+			self.writer.WriteString("\n")
+		}
+		self.writer.WriteString(strings.Repeat(indentation, depth) + "}")
+	case ArrayType:
+		self.writer.WriteString("array [\n")
+		for _, v := range value.Value.([]Value) {
+			self.writer.WriteString(indent)
+			self.dump(v, depth+1)
+			self.writer.WriteString("\n")
+		}
+		self.writer.WriteString(strings.Repeat(indentation, depth) + "]")
+	default:
+		self.colored(dumpColors[value.Type], value.dumpScalar())
+	}
+}
+
+func (self Value) dumpScalar() string {
+	switch self.Type {
+	case StringType:
+		return strconv.Quote(self.Value.(string))
+	case DateType:
+		return self.Value.(time.Time).Format(time.RFC3339Nano)
+	case DataType:
+		data := self.data()
+		text := "<" + strconv.Itoa(len(data)) + " bytes"
+		if len(data) > 0 {
+			shown := data
+			if len(shown) > dumpDataBytes {
+				shown = shown[:dumpDataBytes]
+			}
+			text += " " + hex.EncodeToString(shown)
+			if len(shown) < len(data) {
+				text += "..."
+			}
+		}
+		return text + ">"
+	case IntegerType, RealType, BooleanType, UIDType:
+		return self.scalarString()
+	case NullType:
+		return "null"
+	}
+	return "invalid"
+}
+
+func (self Value) dump(writer io.Writer, color bool) error {
+	d := &dumper{writer: bufio.NewWriter(writer), color: color}
+	d.dump(self, 0)
+	d.writer.WriteString("\n")
+	return d.writer.Flush()
+}
+
+// Dump writes a human readable representation of the tree to writer, for
+// debugging. Dict keys are sorted, strings quoted and data values shortened.
+func (self Value) Dump(writer io.Writer) error {
+	return self.dump(writer, false)
+}
+
+// ColorDump writes the Dump representation highlighted with ANSI colors:
+// keys bold, strings green, numbers cyan, booleans yellow, dates purple and
+// data blue. Colors are only used when writer is a terminal and the NO_COLOR
+// environment variable is not set, otherwise the output equals Dump.
+func (self Value) ColorDump(writer io.Writer) error {
+	return self.dump(writer, isTerminal(writer) && os.Getenv("NO_COLOR") == "")
+}
+
+func isTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
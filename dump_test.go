@@ -0,0 +1,71 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dumpTestValue() Value {
+	return Value{map[string]Value{
+		"name":  {"Üsér", StringType},
+		"count": {int64(-3), IntegerType},
+		"items": {[]Value{
+			{true, BooleanType},
+			{2.5, RealType},
+			{bytes.Repeat([]byte{0xab}, 20), DataType},
+		}, ArrayType},
+		"when": {time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC), DateType},
+	}, DictType}
+}
+
+func TestDump(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := dumpTestValue().Dump(&buffer); err != nil {
+		t.Fatalf("Dump failed: %s", err)
+	}
+	expected := `dict {
+  "count": -3
+  "items": array [
+    true
+    2.5
+    <20 bytes abababababababababababababababab...>
+  ]
+  "name": "Üsér"
+  "when": 2016-11-01T08:46:41Z
+}
+`
+	if buffer.String() != expected {
+		t.Errorf("unexpected output:\n%s", buffer.String())
+	}
+}
+
+func TestColorDump(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := dumpTestValue().ColorDump(&buffer); err != nil {
+		t.Fatalf("ColorDump failed: %s", err)
+	}
+	if strings.Contains(buffer.String(), "\x1b[") {
+		t.Errorf("no colors expected for a non-terminal writer")
+	}
+
+	buffer.Reset()
+	if err := dumpTestValue().dump(&buffer, true); err != nil {
+		t.Fatalf("dump failed: %s", err)
+	}
+	out := buffer.String()
+	for _, fragment := range []string{
+		colorBold + `"name"` + colorReset,
+		colorGreen + `"Üsér"` + colorReset,
+		colorCyan + "-3" + colorReset,
+		colorCyan + "2.5" + colorReset,
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %q:\n%s", fragment, out)
+		}
+	}
+}
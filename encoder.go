@@ -0,0 +1,530 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultXMLDeclaration = `<?xml version="1.0" encoding="UTF-8"?>`
+	defaultDoctype        = `<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`
+)
+
+// KeySort selects the order in which dict keys are written.
+type KeySort int
+
+const (
+	// LexicalSort orders keys by comparing their bytes, see sort.Strings.
+	LexicalSort KeySort = iota
+	// CaseInsensitiveSort orders keys ignoring case, matching CoreFoundation.
+	// Keys which only differ in case are ordered lexically.
+	CaseInsensitiveSort
+	// CustomSort orders keys with WriteOptions.KeyLess.
+	CustomSort
+	// PreserveSort keeps the order of dicts held as *OrderedDict. Keys
+	// missing from OrderedDict.Keys and dicts held as map[string]Value are
+	// ordered lexically.
+	PreserveSort
+)
+
+// WriteOptions control how plist documents are written.
+// The zero value writes documents the same way Value.Write does.
+type WriteOptions struct {
+	// XMLDeclaration replaces the default `<?xml version="1.0" encoding="UTF-8"?>` line.
+	XMLDeclaration string
+	// Doctype replaces the default Apple PLIST 1.0 DOCTYPE line, e.g. to
+	// reference a mirrored DTD.
+	Doctype string
+	// Canonical writes a canonical form in which semantically equal values
+	// produce identical bytes, e.g. for signing. Keys are sorted, reals use the
+	// shortest round-trip formatting without an exponent for integral values,
+	// dates are written in UTC with fractional seconds only when non-zero,
+	// and the default XML declaration and DOCTYPE are always used.
+	Canonical bool
+	// FractionalSeconds keeps the sub-second part of dates, which are
+	// otherwise truncated to whole seconds.
+	FractionalSeconds bool
+	// DateZone selects the time zone dates are written in, UTCDates by
+	// default. Canonical output always uses UTC.
+	DateZone DateZone
+	// DataEncoding encodes the text of data values, base64.StdEncoding by
+	// default. Canonical output always uses base64.StdEncoding.
+	DataEncoding *base64.Encoding
+	// DataWrapWidth wraps the base64 text of data values into lines of at
+	// most this many characters. Zero, the default, writes each data value
+	// as a single line without any whitespace inside the element. Canonical
+	// output ignores it.
+	DataWrapWidth int
+	// Compact omits all indentation and line breaks between elements.
+	// Data values are then never wrapped. Canonical output ignores it.
+	Compact bool
+	// IntegerBase selects the base of integers, 10 (or zero) for decimal and
+	// 16 for hexadecimal with a "0x" prefix. Negative integers are always
+	// written in decimal. Canonical output ignores it.
+	IntegerBase int
+	// HexIntegers lists the key paths of integers to write in hexadecimal
+	// regardless of IntegerBase, e.g. "Registers.0.Mask". Canonical output
+	// ignores it.
+	HexIntegers []string
+	// Metadata reproduces details recorded while decoding a document, such
+	// as the original text of numbers or element attributes. Canonical output
+	// ignores it.
+	Metadata *Metadata
+	// KeySort selects the order of dict keys, LexicalSort by default.
+	// Canonical output always uses LexicalSort.
+	KeySort KeySort
+	// KeyLess reports whether key a sorts before key b when KeySort is CustomSort.
+	KeyLess func(a, b string) bool
+	// KeyOrder maps the key paths of dicts to keys written first, in the
+	// given order. The entry "*" applies to all dicts without an entry of
+	// their own. Listed keys missing from a dict are skipped, the remaining
+	// keys follow in the order of KeySort. Canonical output ignores it.
+	KeyOrder map[string][]string
+	// InvalidChars selects how characters XML cannot represent in strings
+	// and dict keys are handled, RejectInvalidChars by default.
+	InvalidChars InvalidCharPolicy
+	// NonFinite selects how NaN and infinite reals are handled,
+	// RejectNonFinite by default.
+	NonFinite NonFinitePolicy
+	// RealDecimalPoint writes finite reals which have no fraction in their
+	// shortest text with ".0", e.g. "2.0" instead of "2" and "1.0e+21"
+	// instead of "1e+21". Canonical output ignores it.
+	RealDecimalPoint bool
+	// FormatReal formats finite reals instead of the shortest text which
+	// reads back exactly, see also FixedReal.
+	FormatReal RealFormat
+	// FormatDate formats dates instead of DateZone and FractionalSeconds.
+	FormatDate func(time.Time) string
+	// FormatInteger formats integers up to math.MaxInt64 instead of
+	// IntegerBase and HexIntegers.
+	//
+	// The text of the Format hooks is escaped as needed. It must be readable
+	// by this package, otherwise writing fails with a *FormatError before
+	// anything is written. Canonical output ignores the hooks.
+	FormatInteger func(int64) string
+	// ASCIIOnly writes all characters outside ASCII in strings, dict keys
+	// and attributes as character references like &#xE9;, which is also
+	// done when the XML declaration names an ASCII encoding.
+	ASCIIOnly bool
+	// CDATAThreshold writes strings in which at least this fraction of the
+	// bytes would be escaped, like "<", "&" or quotes, as CDATA sections
+	// instead, e.g. 0.1 for markup snippets. Strings holding carriage
+	// returns or characters which need character references are always
+	// escaped. Zero, the default, never writes CDATA. Canonical output
+	// ignores it.
+	CDATAThreshold float64
+	// Comments maps the key paths of dict entries and array elements to
+	// comments written on the line before their key or element, e.g.
+	// "Settings.Timeout" to "In seconds". The empty path places a comment
+	// before the root value. Lines after the first are indented like the
+	// comment. They take precedence over comments recorded in the Metadata.
+	// Comments must not contain "--" or end with "-". Canonical output
+	// ignores them.
+	Comments map[string]string
+	// FragmentDepth is the indentation depth at which Value.WriteFragment
+	// writes the value.
+	FragmentDepth int
+	// Verify makes Encode write the document to a buffer first, read it back
+	// and compare it with the value. Only a document which reads back equal
+	// is written, otherwise a *VerifyError is returned. Options which lose
+	// information, like dates with fractional seconds written without
+	// FractionalSeconds, Format hooks or null values, fail verification.
+	// Streamed documents are not verified.
+	Verify bool
+	// Progress is called with the number of bytes of the document written so
+	// far each time a buffer of output is passed to the writer, about every
+	// 4 KiB, and when the document is complete.
+	Progress func(written int64)
+	// KeyCache keeps the sorted keys of large dicts for the following writes
+	// of the same Value, which then skip sorting unchanged dicts.
+	KeyCache *KeyCache
+}
+
+// DateZone selects the time zone of written dates.
+type DateZone int
+
+const (
+	// UTCDates writes dates in UTC with a Z suffix, like CoreFoundation.
+	UTCDates DateZone = iota
+	// LocalDates writes dates in the local time zone with its offset.
+	LocalDates
+	// PreserveDates writes dates in the location of their time.Time, so the
+	// offsets of decoded dates are kept.
+	PreserveDates
+)
+
+// NonFinitePolicy selects how NaN and infinite reals are written.
+type NonFinitePolicy int
+
+const (
+	// RejectNonFinite fails with a *NonFiniteError before anything is
+	// written.
+	RejectNonFinite NonFinitePolicy = iota
+	// WriteNonFinite writes the spellings CFPropertyList accepts: nan,
+	// +infinity and -infinity.
+	WriteNonFinite
+)
+
+// NonFiniteError reports a NaN or infinite real rejected by RejectNonFinite.
+type NonFiniteError struct {
+	// Path is the key path of the real.
+	Path  string
+	Value float64
+}
+
+func (self *NonFiniteError) Error() string {
+	return fmt.Sprintf("Non-finite real %v at %q", self.Value, self.Path)
+}
+
+func canonicalReal(f float64) string {
+	if f == math.Trunc(f) && !math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// xmlDeclaration returns the XML declaration line. Without XMLDeclaration the
+// encoding recorded in the Metadata is declared.
+func (self *WriteOptions) xmlDeclaration() string {
+	if self.Canonical {
+		return defaultXMLDeclaration
+	}
+	if self.XMLDeclaration != "" {
+		return strings.TrimSpace(self.XMLDeclaration)
+	}
+	if encoding := self.Metadata.Encoding(); encoding != "" {
+		return `<?xml version="1.0" encoding="` + encoding + `"?>`
+	}
+	return defaultXMLDeclaration
+}
+
+func (self *WriteOptions) doctype() string {
+	if self.Doctype == "" || self.Canonical {
+		return defaultDoctype
+	}
+	return strings.TrimSpace(self.Doctype)
+}
+
+func (self *WriteOptions) dictKeys(dict Value) []string {
+	if ordered, ok := dict.Value.(*OrderedDict); ok && self.KeySort == PreserveSort && !self.Canonical {
+		return ordered.orderedKeys()
+	}
+	return self.sortedKeys(dict.dictMap())
+}
+
+// orderKeys moves the keys listed in KeyOrder for the dict at path to the
+// front of keys.
+func (self *WriteOptions) orderKeys(path string, keys []string) []string {
+	order, ok := self.KeyOrder[path]
+	if !ok {
+		order = self.KeyOrder["*"]
+	}
+	if len(order) == 0 || self.Canonical {
+		return keys
+	}
+	present := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		present[key] = true
+	}
+	result := make([]string, 0, len(keys))
+	first := make(map[string]bool, len(order))
+	for _, key := range order {
+		if present[key] {
+			result = append(result, key)
+			first[key] = true
+		}
+	}
+	for _, key := range keys {
+		if !first[key] {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// sortedKeys returns the keys of m in the order of KeySort. The result may be
+// shared with the KeyCache and must not be modified.
+func (self *WriteOptions) sortedKeys(m map[string]Value) []string {
+	keySort := self.KeySort
+	if self.Canonical || keySort == PreserveSort {
+		keySort = LexicalSort
+	}
+	if self.KeyCache == nil || len(m) < minCachedKeys {
+		return self.sortKeys(m, keySort)
+	}
+	if keys, ok := self.KeyCache.lookup(m, keySort); ok {
+		return keys
+	}
+	keys := self.sortKeys(m, keySort)
+	self.KeyCache.store(m, keySort, keys)
+	return keys
+}
+
+func (self *WriteOptions) sortKeys(m map[string]Value, keySort KeySort) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	switch keySort {
+	case LexicalSort:
+		sort.Strings(keys)
+	case CaseInsensitiveSort:
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := strings.ToLower(keys[i]), strings.ToLower(keys[j])
+			if a == b {
+				return keys[i] < keys[j]
+			}
+			return a < b
+		})
+	case CustomSort:
+		sort.Slice(keys, func(i, j int) bool {
+			return self.KeyLess(keys[i], keys[j])
+		})
+	}
+	return keys
+}
+
+func (self *WriteOptions) validate() error {
+	if self.XMLDeclaration != "" {
+		declaration := strings.TrimSpace(self.XMLDeclaration)
+		if !strings.HasPrefix(declaration, "<?xml ") || !strings.HasSuffix(declaration, "?>") {
+			return fmt.Errorf("Invalid XML declaration %q", self.XMLDeclaration)
+		}
+	}
+	if self.Doctype != "" {
+		doctype := strings.TrimSpace(self.Doctype)
+		if !strings.HasPrefix(doctype, "<!DOCTYPE ") || !strings.HasSuffix(doctype, ">") {
+			return fmt.Errorf("Invalid DOCTYPE %q", self.Doctype)
+		}
+	}
+	switch self.KeySort {
+	case LexicalSort, CaseInsensitiveSort, PreserveSort:
+	case CustomSort:
+		if self.KeyLess == nil {
+			return fmt.Errorf("CustomSort requires KeyLess")
+		}
+	default:
+		return fmt.Errorf("Invalid KeySort %d", self.KeySort)
+	}
+	if self.IntegerBase != 0 && self.IntegerBase != 10 && self.IntegerBase != 16 {
+		return fmt.Errorf("Invalid IntegerBase %d", self.IntegerBase)
+	}
+	if self.DataWrapWidth < 0 {
+		return fmt.Errorf("Invalid DataWrapWidth %d", self.DataWrapWidth)
+	}
+	if self.CDATAThreshold < 0 || self.CDATAThreshold > 1 {
+		return fmt.Errorf("Invalid CDATAThreshold %g", self.CDATAThreshold)
+	}
+	if self.FragmentDepth < 0 {
+		return fmt.Errorf("Invalid FragmentDepth %d", self.FragmentDepth)
+	}
+	for path, keys := range self.KeyOrder {
+		seen := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			if seen[key] {
+				return fmt.Errorf("Duplicate key %q in KeyOrder of %q", key, path)
+			}
+			seen[key] = true
+		}
+	}
+	if err := self.checkFormatSamples(); err != nil {
+		return err
+	}
+	if self.DateZone < UTCDates || self.DateZone > PreserveDates {
+		return fmt.Errorf("Invalid DateZone %d", self.DateZone)
+	}
+	if self.NonFinite != RejectNonFinite && self.NonFinite != WriteNonFinite {
+		return fmt.Errorf("Invalid NonFinite %d", self.NonFinite)
+	}
+	if self.InvalidChars < RejectInvalidChars || self.InvalidChars > ReplaceInvalidChars {
+		return fmt.Errorf("Invalid InvalidChars %d", self.InvalidChars)
+	}
+	for path, text := range self.Comments {
+		if strings.Contains(text, "--") || strings.HasSuffix(text, "-") {
+			return fmt.Errorf("Invalid comment %q for %q, comments must not contain -- or end with -", text, path)
+		}
+		if r, ok := invalidChar(text); ok {
+			return fmt.Errorf("Invalid character %q in comment for %q", r, path)
+		}
+		if i := strings.IndexFunc(text, func(r rune) bool { return r > unicode.MaxASCII }); self.ASCIIOnly && i >= 0 {
+			return fmt.Errorf("Non-ASCII comment for %q cannot be written with ASCIIOnly", path)
+		}
+	}
+	return nil
+}
+
+// checkValue returns the first error the policies of the options report for
+// value, so nothing is written for a value which cannot be encoded.
+func (self *WriteOptions) checkValue(value Value, path []string) error {
+	switch value.Type {
+	case StringType:
+		if r, ok := invalidChar(value.Value.(string)); ok && self.InvalidChars == RejectInvalidChars {
+			return &InvalidCharError{Path: joinPath(path), Char: r}
+		}
+	case RealType:
+		if f := value.Value.(float64); (math.IsNaN(f) || math.IsInf(f, 0)) && self.NonFinite == RejectNonFinite {
+			return &NonFiniteError{Path: joinPath(path), Value: f}
+		} else if err := self.checkFormat(path, value); err != nil {
+			return err
+		}
+	case IntegerType, DateType:
+		if err := self.checkFormat(path, value); err != nil {
+			return err
+		}
+	case ArrayType:
+		for i, v := range value.Value.([]Value) {
+			if err := self.checkValue(v, append(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	case DictType:
+		// Check in key order, so the same value always reports the same error.
+		m := value.dictMap()
+		for _, k := range value.dictKeys() {
+			if r, ok := invalidChar(k); ok && self.InvalidChars == RejectInvalidChars {
+				return &InvalidCharError{Path: joinPath(append(path, k)), Key: true, Char: r}
+			}
+			if err := self.checkValue(m[k], append(path, k)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written to writer.
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (self *countingWriter) Write(p []byte) (int, error) {
+	n, err := self.writer.Write(p)
+	self.n += int64(n)
+	return n, err
+}
+
+// progressWriter reports the number of bytes written after every write.
+type progressWriter struct {
+	countingWriter
+	progress func(int64)
+}
+
+func (self *progressWriter) Write(p []byte) (int, error) {
+	n, err := self.countingWriter.Write(p)
+	self.progress(self.n)
+	return n, err
+}
+
+// Encoder writes plist documents to an output stream. Several documents can
+// be written one after the other, an Encoder reuses its buffers for each.
+type Encoder struct {
+	WriteOptions
+	writer io.Writer
+	// xmlWriter is kept between documents to reuse its buffers.
+	xmlWriter *xmlWriter
+	// stream holds the state of a document written with the streaming
+	// methods, see BeginDict.
+	stream *encoderStream
+}
+
+// NewEncoder returns an Encoder writing to writer with default options.
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{writer: writer}
+}
+
+// Reset discards any unfinished streamed document and makes the Encoder write
+// to writer, keeping the options and buffers.
+func (self *Encoder) Reset(writer io.Writer) {
+	self.writer = writer
+	self.stream = nil
+}
+
+// Encode writes the plist document representing value. The document is
+// buffered internally and flushed before Encode returns, short writes of the
+// underlying writer are reported as io.ErrShortWrite.
+func (self *Encoder) Encode(value Value) error {
+	return self.EncodeContext(context.Background(), value)
+}
+
+// EncodeContext writes the plist document representing value like Encode,
+// but stops with ctx.Err() when ctx is done. The context is checked before
+// each element, a write blocking in the underlying writer is not
+// interrupted. Part of the document may have been written when
+// EncodeContext returns an error.
+func (self *Encoder) EncodeContext(ctx context.Context, value Value) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if self.stream != nil {
+		return fmt.Errorf("Encode while a streamed document is unfinished")
+	}
+	if err := self.validate(); err != nil {
+		return err
+	}
+	if err := self.checkValue(value, nil); err != nil {
+		return err
+	}
+	if self.Verify {
+		return self.encodeVerified(ctx, value)
+	}
+	return self.encode(ctx, value)
+}
+
+func (self *Encoder) encode(ctx context.Context, value Value) error {
+	writer := self.startDocument()
+	writer.ctx, writer.done = ctx, ctx.Done()
+	if err := writer.writeValue(value); err != nil {
+		return err
+	}
+	return self.endDocument(writer)
+}
+
+// startDocument writes the prologue and the plist start tag.
+func (self *Encoder) startDocument() *xmlWriter {
+	output := self.writer
+	if self.Progress != nil {
+		output = &progressWriter{countingWriter{writer: output}, self.Progress}
+	}
+	if self.xmlWriter == nil {
+		self.xmlWriter = newXmlWriter(bufio.NewWriter(output), &self.WriteOptions)
+	} else {
+		// Discards output left over by a failed document.
+		self.xmlWriter.writer.Reset(output)
+		self.xmlWriter.reset(&self.WriteOptions)
+	}
+	writer := self.xmlWriter
+	writer.write(self.xmlDeclaration() + "\n" + self.doctype() + "\n")
+	writer.attributes = []xml.Attr{{Name: xml.Name{Local: "version"}, Value: "1.0"}}
+	if attributes := self.Metadata.PlistAttributes(); attributes != nil && !self.Canonical {
+		writer.attributes = attributes
+	}
+	writer.startTag("plist", false)
+	writer.depth = 1
+	writer.comment(nil)
+	return writer
+}
+
+// endDocument writes the plist end tag and flushes the output.
+func (self *Encoder) endDocument(writer *xmlWriter) error {
+	writer.depth = 0
+	writer.newline()
+	writer.write("</plist>")
+	if writer.err != nil {
+		return writer.err
+	}
+	return writer.writer.Flush()
+}
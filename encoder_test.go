@@ -0,0 +1,1354 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func encodeString(t *testing.T, encoder func(*plist.Encoder), value plist.Value) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	e := plist.NewEncoder(&buffer)
+	if encoder != nil {
+		encoder(e)
+	}
+	if err := e.Encode(value); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	return buffer.String()
+}
+
+func TestWriteDefaultPreamble(t *testing.T) {
+	out := encodeString(t, nil, plist.Value{Value: "x", Type: plist.StringType})
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+  <string>x</string>
+</plist>`
+	if out != expected {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestWriteCustomPreamble(t *testing.T) {
+	doctype := `<!DOCTYPE plist SYSTEM "https://mirror.example.com/PropertyList-1.0.dtd">`
+	out := encodeString(t, func(e *plist.Encoder) {
+		e.Doctype = doctype
+		e.XMLDeclaration = `<?xml version="1.0"?>`
+	}, plist.Value{Value: "x", Type: plist.StringType})
+	if !strings.HasPrefix(out, `<?xml version="1.0"?>`+"\n"+doctype+"\n<plist") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	mustRead(t, out)
+}
+
+func TestWriteInvalidPreamble(t *testing.T) {
+	for _, options := range []plist.WriteOptions{
+		{Doctype: "   "},
+		{Doctype: "plist"},
+		{XMLDeclaration: "\n"},
+		{XMLDeclaration: "<xml>"},
+	} {
+		e := plist.NewEncoder(&bytes.Buffer{})
+		e.WriteOptions = options
+		if err := e.Encode(plist.Value{Value: "x", Type: plist.StringType}); err == nil {
+			t.Errorf("expected an error for %#v", options)
+		}
+	}
+}
+
+func canonicalTestValue(order []string, zone *time.Location) plist.Value {
+	entries := map[string]plist.Value{
+		"when":     {Value: time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC).In(zone), Type: plist.DateType},
+		"precise":  {Value: time.Date(2016, 11, 1, 8, 46, 41, 500000000, time.UTC).In(zone), Type: plist.DateType},
+		"integral": {Value: -20000.0, Type: plist.RealType},
+		"fraction": {Value: 0.1, Type: plist.RealType},
+		"count":    {Value: int64(255), Type: plist.IntegerType},
+		"blob":     {Value: bytes.Repeat([]byte{0xfe, 0xed}, 64), Type: plist.DataType},
+		"name":     {Value: "Üsér", Type: plist.StringType},
+	}
+	m := map[string]plist.Value{}
+	for _, key := range order {
+		m[key] = entries[key]
+	}
+	return plist.Value{Value: m, Type: plist.DictType}
+}
+
+func TestWriteCanonical(t *testing.T) {
+	canonical := func(e *plist.Encoder) {
+		e.Canonical = true
+		e.Doctype = `<!DOCTYPE plist SYSTEM "ignored.dtd">`
+	}
+	order := []string{"when", "precise", "integral", "fraction", "count", "blob", "name"}
+	expected := encodeString(t, canonical, canonicalTestValue(order, time.UTC))
+
+	reversed := make([]string, len(order))
+	for i, key := range order {
+		reversed[len(order)-1-i] = key
+	}
+	zone := time.FixedZone("UTC-7", -7*3600)
+	if out := encodeString(t, canonical, canonicalTestValue(reversed, zone)); out != expected {
+		t.Errorf("canonical output differs:\n%s\n%s", out, expected)
+	}
+	if out := encodeString(t, canonical, mustRead(t, expected)); out != expected {
+		t.Errorf("canonical output differs after re-parsing:\n%s\n%s", out, expected)
+	}
+	layout := func(e *plist.Encoder) {
+		canonical(e)
+		e.DataWrapWidth = 4
+		e.Compact = true
+		e.IntegerBase = 16
+		e.HexIntegers = []string{"count"}
+	}
+	if out := encodeString(t, layout, canonicalTestValue(order, time.UTC)); out != expected {
+		t.Errorf("canonical output differs with layout options:\n%s\n%s", out, expected)
+	}
+	for _, fragment := range []string{
+		"<real>-20000</real>",
+		"<real>0.1</real>",
+		"<integer>255</integer>",
+		"<date>2016-11-01T08:46:41Z</date>",
+		"<date>2016-11-01T08:46:41.5Z</date>",
+		"<!DOCTYPE plist PUBLIC",
+	} {
+		if !strings.Contains(expected, fragment) {
+			t.Errorf("canonical output lacks %s:\n%s", fragment, expected)
+		}
+	}
+}
+
+func keyOrder(out string) []string {
+	var keys []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "<key>") {
+			keys = append(keys, strings.TrimSuffix(strings.TrimPrefix(line, "<key>"), "</key>"))
+		}
+	}
+	return keys
+}
+
+func TestWriteKeySort(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"beta":  {Value: "1", Type: plist.StringType},
+		"Alpha": {Value: "2", Type: plist.StringType},
+		"alpha": {Value: "3", Type: plist.StringType},
+		"Gamma": {Value: "4", Type: plist.StringType},
+	}, Type: plist.DictType}
+
+	for _, test := range []struct {
+		options  plist.WriteOptions
+		expected string
+	}{
+		{plist.WriteOptions{}, "Alpha Gamma alpha beta"},
+		{plist.WriteOptions{KeySort: plist.CaseInsensitiveSort}, "Alpha alpha beta Gamma"},
+		{plist.WriteOptions{KeySort: plist.CustomSort, KeyLess: func(a, b string) bool { return a > b }}, "beta alpha Gamma Alpha"},
+		{plist.WriteOptions{KeySort: plist.CaseInsensitiveSort, Canonical: true}, "Alpha Gamma alpha beta"},
+	} {
+		out := encodeString(t, func(e *plist.Encoder) { e.WriteOptions = test.options }, value)
+		if keys := strings.Join(keyOrder(out), " "); keys != test.expected {
+			t.Errorf("KeySort %d: got %s, expected %s", test.options.KeySort, keys, test.expected)
+		}
+	}
+
+	e := plist.NewEncoder(&bytes.Buffer{})
+	e.KeySort = plist.CustomSort
+	if err := e.Encode(value); err == nil {
+		t.Errorf("expected an error for CustomSort without KeyLess")
+	}
+}
+
+// plutilBooleans is the output of `plutil -convert xml1` for a dict holding
+// both booleans.
+const plutilBooleans = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Disabled</key>
+	<false/>
+	<key>Enabled</key>
+	<true/>
+</dict>
+</plist>
+`
+
+// stripIndentation removes leading whitespace from every line so output can be
+// compared with plutil, which indents with tabs.
+func stripIndentation(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestWriteBooleans(t *testing.T) {
+	value := mustRead(t, plutilBooleans)
+	out := encodeString(t, nil, value)
+	if stripIndentation(out) != stripIndentation(plutilBooleans) {
+		t.Errorf("output differs from plutil:\n%s", out)
+	}
+	if strings.Contains(out, "</true>") || strings.Contains(out, "</false>") {
+		t.Errorf("booleans must use empty-element tags:\n%s", out)
+	}
+	reread := mustRead(t, out).Raw().(map[string]interface{})
+	if reread["Enabled"] != true || reread["Disabled"] != false {
+		t.Errorf("unexpected round trip result %v", reread)
+	}
+}
+
+func TestWriteDates(t *testing.T) {
+	zone := time.FixedZone("PDT", -7*3600)
+	when := time.Date(2016, 11, 1, 1, 46, 41, 123456789, zone)
+	value := plist.Value{Value: when, Type: plist.DateType}
+
+	out := encodeString(t, nil, value)
+	// plutil -convert xml1 writes the same form.
+	if !strings.Contains(out, "<date>2016-11-01T08:46:41Z</date>") {
+		t.Errorf("unexpected date output:\n%s", out)
+	}
+	if reread := mustRead(t, out); !reread.Equal(plist.Value{Value: when.Truncate(time.Second), Type: plist.DateType}) {
+		t.Errorf("unexpected round trip result %v", reread.Value)
+	}
+
+	out = encodeString(t, func(e *plist.Encoder) { e.FractionalSeconds = true }, value)
+	if !strings.Contains(out, "<date>2016-11-01T08:46:41.123456789Z</date>") {
+		t.Errorf("unexpected date output:\n%s", out)
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("unexpected round trip result %v", reread.Value)
+	}
+}
+
+func realRoundTrip(t *testing.T, options func(*plist.Encoder), f float64) bool {
+	out := encodeString(t, options, plist.Value{Value: f, Type: plist.RealType})
+	reread, err := plist.Read(strings.NewReader(out))
+	if err != nil {
+		t.Logf("Read failed for %v: %s", f, err)
+		return false
+	}
+	return math.Float64bits(reread.Value.(float64)) == math.Float64bits(f)
+}
+
+func TestWriteRealsRoundTrip(t *testing.T) {
+	for _, f := range []float64{
+		0, math.Copysign(0, -1), -20000, 0.1, 1.0 / 3, -14242424.342,
+		math.MaxFloat64, -math.MaxFloat64, math.SmallestNonzeroFloat64, 1e-300, 1e21, 123456789012345678,
+		// Subnormals, down to the smallest and up to the largest.
+		-math.SmallestNonzeroFloat64, math.Float64frombits(0x000fffffffffffff), math.Float64frombits(0x8000000000000123), 1e-310,
+	} {
+		for _, options := range []plist.WriteOptions{{}, {Canonical: true}, {RealDecimalPoint: true}} {
+			if !realRoundTrip(t, func(e *plist.Encoder) { e.WriteOptions = options }, f) {
+				t.Errorf("%v does not round trip with %+v", f, options)
+			}
+		}
+	}
+	for f, text := range map[float64]string{
+		math.Copysign(0, -1):                     "<real>-0</real>",
+		math.SmallestNonzeroFloat64:              "<real>5e-324</real>",
+		-math.SmallestNonzeroFloat64:             "<real>-5e-324</real>",
+		math.Float64frombits(0x000fffffffffffff): "<real>2.225073858507201e-308</real>",
+	} {
+		if out := encodeString(t, nil, plist.Value{Value: f, Type: plist.RealType}); !strings.Contains(out, text) {
+			t.Errorf("output lacks %s:\n%s", text, out)
+		}
+	}
+
+	property := func(bits uint64) bool {
+		f := math.Float64frombits(bits)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return true
+		}
+		return realRoundTrip(t, nil, f) && realRoundTrip(t, func(e *plist.Encoder) { e.Canonical = true }, f)
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteRealShortest(t *testing.T) {
+	out := encodeString(t, nil, plist.Value{Value: -2.0e+04, Type: plist.RealType})
+	if !strings.Contains(out, "<real>-20000</real>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestWriteRealDecimalPoint(t *testing.T) {
+	value := plist.Value{Value: []plist.Value{
+		{Value: 2.0, Type: plist.RealType},
+		{Value: -2.0e+04, Type: plist.RealType},
+		{Value: 1.5, Type: plist.RealType},
+		{Value: 1e21, Type: plist.RealType},
+		{Value: 1.5e-7, Type: plist.RealType},
+		{Value: math.Copysign(0, -1), Type: plist.RealType},
+	}, Type: plist.ArrayType}
+	out := encodeString(t, func(e *plist.Encoder) { e.RealDecimalPoint = true }, value)
+	for _, fragment := range []string{"<real>2.0</real>", "<real>-20000.0</real>", "<real>1.5</real>", "<real>1.0e+21</real>", "<real>1.5e-07</real>", "<real>-0.0</real>"} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("unexpected round trip result %v", reread.Raw())
+	}
+	if out := encodeString(t, nil, value); !strings.Contains(out, "<real>2</real>") {
+		t.Errorf("expected the shortest text by default:\n%s", out)
+	}
+}
+
+func TestWriteDataSingleLine(t *testing.T) {
+	blob := make([]byte, 4096)
+	for i := range blob {
+		blob[i] = byte(i * 7)
+	}
+	value := plist.Value{Value: []plist.Value{{Value: blob, Type: plist.DataType}}, Type: plist.ArrayType}
+	for _, options := range []func(*plist.Encoder){
+		nil,
+		func(e *plist.Encoder) { e.Compact = true },
+		func(e *plist.Encoder) { e.Compact = true; e.DataWrapWidth = 68 },
+	} {
+		out := encodeString(t, options, value)
+		start := strings.Index(out, "<data>") + len("<data>")
+		end := strings.Index(out, "</data>")
+		text := out[start:end]
+		if strings.ContainsAny(text, " \t\r\n") {
+			t.Errorf("data contains whitespace")
+		}
+		if text != base64.StdEncoding.EncodeToString(blob) {
+			t.Errorf("unexpected data text")
+		}
+	}
+}
+
+func TestWriteCompact(t *testing.T) {
+	value := mustRead(t, orderedDocument)
+	out := encodeString(t, func(e *plist.Encoder) { e.Compact = true }, value)
+	body := out[strings.Index(out, "<plist"):]
+	if strings.ContainsAny(body, "\n\t") || strings.Contains(body, "  ") {
+		t.Errorf("unexpected whitespace in compact output:\n%s", out)
+	}
+	if !mustRead(t, out).Equal(value) {
+		t.Errorf("compact output does not round trip")
+	}
+}
+
+func TestWriteDataWrapped(t *testing.T) {
+	blob := bytes.Repeat([]byte{0xfe}, 100)
+	value := plist.Value{Value: map[string]plist.Value{"blob": {Value: blob, Type: plist.DataType}}, Type: plist.DictType}
+	out := encodeString(t, func(e *plist.Encoder) { e.DataWrapWidth = 40 }, value)
+	text := base64.StdEncoding.EncodeToString(blob)
+	expected := "\n    <data>\n    " + text[:40] + "\n    " + text[40:80] + "\n    " + text[80:120] + "\n    " + text[120:] + "\n    </data>\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if !mustRead(t, out).Equal(value) {
+		t.Errorf("wrapped output does not round trip")
+	}
+}
+
+func TestWriteHexIntegers(t *testing.T) {
+	value := mustRead(t, `<plist version="1.0"><dict>
+		<key>Registers</key><array>
+			<dict><key>Mask</key><integer>43981</integer><key>Count</key><integer>3</integer></dict>
+		</array>
+		<key>Offset</key><integer>-16</integer>
+	</dict></plist>`)
+
+	out := encodeString(t, func(e *plist.Encoder) { e.HexIntegers = []string{"Registers.0.Mask"} }, value)
+	if !strings.Contains(out, "<integer>0xABCD</integer>") || !strings.Contains(out, "<integer>3</integer>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if !mustRead(t, out).Equal(value) {
+		t.Errorf("hex output does not round trip")
+	}
+
+	out = encodeString(t, func(e *plist.Encoder) { e.IntegerBase = 16 }, value)
+	if !strings.Contains(out, "<integer>0x3</integer>") || !strings.Contains(out, "<integer>-16</integer>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if !mustRead(t, out).Equal(value) {
+		t.Errorf("hex output does not round trip")
+	}
+
+	e := plist.NewEncoder(&bytes.Buffer{})
+	e.IntegerBase = 8
+	if err := e.Encode(value); err == nil {
+		t.Errorf("expected an error for IntegerBase 8")
+	}
+}
+
+func TestWritePreservedNumberText(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(`<plist version="1.0"><dict>
+		<key>real</key><real>-2.0e+04</real>
+		<key>hex</key><integer>0x1F</integer>
+		<key>edited</key><real>1.50</real>
+		<key>list</key><array><integer>007</integer><integer>+8</integer></array>
+	</dict></plist>`))
+	decoder.PreserveNumberText = true
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	m := value.Value.(map[string]plist.Value)
+	m["edited"] = plist.Value{Value: 2.5, Type: plist.RealType}
+	list := m["list"].Value.([]plist.Value)
+	list[1] = plist.Value{Value: int64(9), Type: plist.IntegerType}
+
+	out := encodeString(t, func(e *plist.Encoder) { e.Metadata = decoder.Metadata() }, value)
+	for _, fragment := range []string{
+		"<real>-2.0e+04</real>",
+		"<integer>0x1F</integer>",
+		"<real>2.5</real>",
+		"<integer>007</integer>",
+		"<integer>9</integer>",
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+	if out := encodeString(t, nil, value); strings.Contains(out, "0x1F") {
+		t.Errorf("number text must only be used with Metadata:\n%s", out)
+	}
+	if decoder := plist.NewDecoder(strings.NewReader(orderedDocument)); decoder.Metadata() != nil {
+		t.Errorf("expected no Metadata without recording options")
+	}
+}
+
+func TestWriteEmptyElements(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"array":  {Value: []plist.Value{}, Type: plist.ArrayType},
+		"data":   {Value: []byte{}, Type: plist.DataType},
+		"dict":   {Value: map[string]plist.Value{}, Type: plist.DictType},
+		"string": {Value: "", Type: plist.StringType},
+	}, Type: plist.DictType}
+	out := encodeString(t, nil, value)
+	for _, tag := range []string{"<array/>", "<data/>", "<dict/>", "<string/>"} {
+		if !strings.Contains(out, tag) {
+			t.Errorf("output lacks %s:\n%s", tag, out)
+		}
+	}
+	if !mustRead(t, out).Equal(value) {
+		t.Errorf("unexpected round trip result %v", mustRead(t, out).Raw())
+	}
+}
+
+func TestWriteInvalidChars(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"list": {Value: []plist.Value{
+			{Value: "ok", Type: plist.StringType},
+			{Value: "a\x01b\xffc", Type: plist.StringType},
+		}, Type: plist.ArrayType},
+	}, Type: plist.DictType}
+	var buffer bytes.Buffer
+	err := plist.NewEncoder(&buffer).Encode(value)
+	if charErr, ok := err.(*plist.InvalidCharError); !ok || charErr.Path != "list.1" || charErr.Char != 1 || charErr.Key {
+		t.Errorf("unexpected error %v", err)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected no output, got %q", buffer.String())
+	}
+
+	key := plist.Value{Value: map[string]plist.Value{
+		"bad\x00key": {Value: "x", Type: plist.StringType},
+	}, Type: plist.DictType}
+	err = plist.NewEncoder(&buffer).Encode(key)
+	if charErr, ok := err.(*plist.InvalidCharError); !ok || charErr.Path != "bad\x00key" || !charErr.Key {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// The first invalid entry in key order is reported.
+	several := plist.Value{Value: map[string]plist.Value{}, Type: plist.DictType}
+	for _, k := range []string{"d", "b", "e", "a", "c"} {
+		several.Value.(map[string]plist.Value)[k] = plist.Value{Value: k + "\x02", Type: plist.StringType}
+	}
+	for i := 0; i < 20; i++ {
+		err = plist.NewEncoder(&buffer).Encode(several)
+		if charErr, ok := err.(*plist.InvalidCharError); !ok || charErr.Path != "a" {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	out := encodeString(t, func(e *plist.Encoder) { e.InvalidChars = plist.StripInvalidChars }, value)
+	if !strings.Contains(out, "<string>abc</string>") {
+		t.Errorf("expected stripped characters:\n%s", out)
+	}
+	out = encodeString(t, func(e *plist.Encoder) { e.InvalidChars = plist.ReplaceInvalidChars }, key)
+	if !strings.Contains(out, "<key>bad\uFFFDkey</key>") {
+		t.Errorf("expected replaced characters:\n%s", out)
+	}
+}
+
+func TestWriteKeptAttributes(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(`<plist version="1.0" xmlns:v="urn:vendor" v:build="12">
+	<dict vendor="x">
+		<key id="ignored">name</key><string v:lang="en">Example</string>
+		<key>list</key><array><integer>1</integer><true note="a &amp; b"/></array>
+	</dict></plist>`))
+	decoder.KeepAttributes = true
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	metadata := decoder.Metadata()
+	if attributes := metadata.Attributes("name"); len(attributes) != 1 || attributes[0].Name.Local != "v:lang" {
+		t.Errorf("unexpected attributes %v", attributes)
+	}
+
+	out := encodeString(t, func(e *plist.Encoder) { e.Metadata = metadata }, value)
+	for _, fragment := range []string{
+		`<plist version="1.0" xmlns:v="urn:vendor" v:build="12">`,
+		`<dict vendor="x">`,
+		`<key>name</key>`,
+		`<string v:lang="en">Example</string>`,
+		`<true note="a &amp; b"/>`,
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+	reread := plist.NewDecoder(strings.NewReader(out))
+	reread.KeepAttributes = true
+	if _, err := reread.Decode(); err != nil {
+		t.Fatalf("Decode of the output failed: %s", err)
+	}
+	if !reflect.DeepEqual(reread.Metadata().Attributes("list.1"), metadata.Attributes("list.1")) {
+		t.Errorf("attributes differ after a round trip")
+	}
+
+	out = encodeString(t, func(e *plist.Encoder) { e.Metadata = metadata; e.Canonical = true }, value)
+	if strings.Contains(out, "vendor") {
+		t.Errorf("canonical output must not carry attributes:\n%s", out)
+	}
+}
+
+func TestWriteKeptEncoding(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(`<?xml version='1.0' encoding='US-ASCII'?>
+<plist version="1.0"><string>caf&#xE9;</string></plist>`))
+	decoder.KeepEncoding = true
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if encoding := decoder.Metadata().Encoding(); encoding != "US-ASCII" {
+		t.Fatalf("unexpected encoding %q", encoding)
+	}
+	out := encodeString(t, func(e *plist.Encoder) { e.Metadata = decoder.Metadata() }, value)
+	if !strings.HasPrefix(out, `<?xml version="1.0" encoding="US-ASCII"?>`) || !strings.Contains(out, "<string>caf&#xE9;</string>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("unexpected value after a round trip: %v", reread.Value)
+	}
+
+	out = encodeString(t, func(e *plist.Encoder) { e.Metadata = decoder.Metadata(); e.Canonical = true }, value)
+	if !strings.HasPrefix(out, `<?xml version="1.0" encoding="UTF-8"?>`) || !strings.Contains(out, "<string>café</string>") {
+		t.Errorf("unexpected canonical output:\n%s", out)
+	}
+}
+
+func TestWriteNonFinite(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"list": {Value: []plist.Value{
+			{Value: 1.5, Type: plist.RealType},
+			{Value: math.Inf(-1), Type: plist.RealType},
+		}, Type: plist.ArrayType},
+	}, Type: plist.DictType}
+	var buffer bytes.Buffer
+	err := plist.NewEncoder(&buffer).Encode(value)
+	if nonFinite, ok := err.(*plist.NonFiniteError); !ok || nonFinite.Path != "list.1" || !math.IsInf(nonFinite.Value, -1) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected no output, got %q", buffer.String())
+	}
+
+	reals := plist.Value{Value: []plist.Value{
+		{Value: math.NaN(), Type: plist.RealType},
+		{Value: math.Inf(1), Type: plist.RealType},
+		{Value: math.Inf(-1), Type: plist.RealType},
+	}, Type: plist.ArrayType}
+	out := encodeString(t, func(e *plist.Encoder) { e.NonFinite = plist.WriteNonFinite }, reals)
+	if !strings.Contains(out, "<real>nan</real>") || !strings.Contains(out, "<real>+infinity</real>") || !strings.Contains(out, "<real>-infinity</real>") {
+		t.Errorf("unexpected spellings:\n%s", out)
+	}
+	if reread := mustRead(t, out); !reread.Equal(reals) {
+		t.Errorf("unexpected round trip result %v", reread.Raw())
+	}
+}
+
+func TestWriteUnsignedIntegers(t *testing.T) {
+	value := plist.Value{Value: []plist.Value{
+		{Value: int64(math.MaxInt64), Type: plist.IntegerType},
+		{Value: uint64(math.MaxInt64 + 1), Type: plist.IntegerType},
+		{Value: uint64(math.MaxUint64), Type: plist.IntegerType},
+	}, Type: plist.ArrayType}
+	out := encodeString(t, nil, value)
+	for _, fragment := range []string{
+		"<integer>9223372036854775807</integer>",
+		"<integer>9223372036854775808</integer>",
+		"<integer>18446744073709551615</integer>",
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+	out = encodeString(t, func(e *plist.Encoder) { e.IntegerBase = 16 }, value)
+	if !strings.Contains(out, "<integer>0xFFFFFFFFFFFFFFFF</integer>") {
+		t.Errorf("unexpected hexadecimal output:\n%s", out)
+	}
+	if !value.EqualRaw([]interface{}{math.MaxInt64, uint64(math.MaxInt64 + 1), uint64(math.MaxUint64)}) {
+		t.Errorf("unexpected raw comparison for %v", value.Raw())
+	}
+}
+
+// shortWriter accepts at most limit bytes per call without reporting an error.
+type shortWriter struct {
+	limit int
+}
+
+func (self shortWriter) Write(p []byte) (int, error) {
+	if len(p) > self.limit {
+		return self.limit, nil
+	}
+	return len(p), nil
+}
+
+func TestWriteShortWrite(t *testing.T) {
+	value := plist.Value{Value: "short", Type: plist.StringType}
+	if err := value.Write(shortWriter{limit: 10}); err != io.ErrShortWrite {
+		t.Errorf("expected io.ErrShortWrite, got %v", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.plist")
+	value := plist.Value{Value: []plist.Value{appendRecord(1)}, Type: plist.ArrayType}
+	if err := plist.WriteFile(name, value, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mustRead(t, string(data)).Equal(value) {
+		t.Errorf("unexpected file contents:\n%s", data)
+	}
+	if err := plist.WriteFile(filepath.Join(name, "missing"), value, 0600); err == nil {
+		t.Errorf("expected an error for an invalid path")
+	}
+}
+
+func TestEncoderMultipleDocuments(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	values := []plist.Value{appendRecord(1), {Value: "two", Type: plist.StringType}, appendRecord(3)}
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			t.Fatalf("Encode failed: %s", err)
+		}
+	}
+	read, err := plist.ReadAll(&buffer)
+	if err != nil || len(read) != len(values) {
+		t.Fatalf("unexpected documents %v, %v", read, err)
+	}
+	for i := range values {
+		if !read[i].Equal(values[i]) {
+			t.Errorf("document %d differs: %v", i, read[i].Raw())
+		}
+	}
+
+	if err := encoder.Encode(plist.Value{Value: "\x00", Type: plist.StringType}); err == nil {
+		t.Fatalf("expected an error for an invalid string")
+	}
+	var other bytes.Buffer
+	encoder.Reset(&other)
+	if err := encoder.Encode(values[1]); err != nil {
+		t.Fatalf("Encode after Reset failed: %s", err)
+	}
+	if buffer.Len() != 0 || other.String() != encodeString(t, nil, values[1]) {
+		t.Errorf("unexpected output after Reset:\n%q\n%q", buffer.String(), other.String())
+	}
+}
+
+func BenchmarkEncoderReuse(b *testing.B) {
+	value := appendRecord(1)
+	encoder := plist.NewEncoder(io.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := encoder.Encode(value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkValueWrite(b *testing.B) {
+	value := appendRecord(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := value.Write(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkValueBytes measures Bytes against writing into a new buffer.
+func BenchmarkValueBytes(b *testing.B) {
+	value := appendRecord(1)
+	b.Run("Bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := value.Bytes(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var buffer bytes.Buffer
+			if err := value.Write(&buffer); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestValueBytes(t *testing.T) {
+	first := appendRecord(1)
+	data, err := first.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %s", err)
+	}
+	expected := encodeString(t, nil, first)
+	if string(data) != expected {
+		t.Fatalf("unexpected output:\n%s", data)
+	}
+	// Pooled buffers must not be shared with returned values.
+	if _, err := appendRecord(2).Bytes(); err != nil {
+		t.Fatalf("Bytes failed: %s", err)
+	}
+	if string(data) != expected {
+		t.Errorf("output changed by a later call:\n%s", data)
+	}
+	if _, err := (plist.Value{Value: "\x00", Type: plist.StringType}).Bytes(); err == nil {
+		t.Errorf("expected an error for an invalid string")
+	}
+}
+
+func TestWriteConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := int64(0); i < 8; i++ {
+		value := appendRecord(i)
+		expected := encodeString(t, nil, value)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				var buffer bytes.Buffer
+				if err := value.Write(&buffer); err != nil || buffer.String() != expected {
+					t.Errorf("unexpected output %q, %v", buffer.String(), err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWriteTo(t *testing.T) {
+	value := plist.Value{Value: []plist.Value{appendRecord(1), appendRecord(2)}, Type: plist.ArrayType}
+	var buffer bytes.Buffer
+	var writerTo io.WriterTo = value
+	n, err := writerTo.WriteTo(&buffer)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+	if n != int64(buffer.Len()) || buffer.String() != encodeString(t, nil, value) {
+		t.Errorf("unexpected count %d for %d bytes", n, buffer.Len())
+	}
+	if n, err := value.WriteTo(shortWriter{limit: 10}); err == nil || n != 10 {
+		t.Errorf("unexpected result %d, %v for a short write", n, err)
+	}
+}
+
+func TestWriteKeyOrder(t *testing.T) {
+	payload := func(extra string) plist.Value {
+		return plist.Value{Value: map[string]plist.Value{
+			"Alpha":          {Value: "a", Type: plist.StringType},
+			"PayloadVersion": {Value: int64(1), Type: plist.IntegerType},
+			"PayloadType":    {Value: extra, Type: plist.StringType},
+			"Zulu":           {Value: "z", Type: plist.StringType},
+		}, Type: plist.DictType}
+	}
+	value := plist.Value{Value: map[string]plist.Value{
+		"PayloadContent": {Value: []plist.Value{payload("inner")}, Type: plist.ArrayType},
+		"PayloadType":    {Value: "Configuration", Type: plist.StringType},
+		"Name":           {Value: "profile", Type: plist.StringType},
+	}, Type: plist.DictType}
+	out := encodeString(t, func(e *plist.Encoder) {
+		e.KeyOrder = map[string][]string{
+			"*": {"PayloadType", "PayloadVersion", "Missing"},
+			"":  {"Name"},
+		}
+	}, value)
+	expected := []string{"Name", "PayloadContent", "PayloadType", "PayloadVersion", "Alpha", "Zulu", "PayloadType"}
+	if order := keyOrder(out); strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected key order %v", order)
+	}
+
+	encoder := plist.NewEncoder(&bytes.Buffer{})
+	encoder.KeyOrder = map[string][]string{"*": {"a", "b", "a"}}
+	if err := encoder.Encode(value); err == nil {
+		t.Errorf("expected an error for duplicate KeyOrder entries")
+	}
+}
+
+func TestDataEncoding(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0xbf, 0x01}
+	value := plist.Value{Value: data, Type: plist.DataType}
+	for _, encoding := range []*base64.Encoding{base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		out := encodeString(t, func(e *plist.Encoder) { e.DataEncoding = encoding }, value)
+		if !strings.Contains(out, "<data>"+encoding.EncodeToString(data)+"</data>") {
+			t.Errorf("unexpected data encoding:\n%s", out)
+		}
+		decoder := plist.NewDecoder(strings.NewReader(out))
+		decoder.DataEncoding = encoding
+		decoder.MaxDataBytes = len(data)
+		if reread, err := decoder.Decode(); err != nil || !reread.Equal(value) {
+			t.Errorf("unexpected round trip result %v, %v", reread.Raw(), err)
+		}
+		// Missing padding is tolerated, the URL alphabet is not.
+		if reread, err := plist.Read(strings.NewReader(out)); encoding == base64.RawStdEncoding && (err != nil || !reread.Equal(value)) {
+			t.Errorf("unexpected result %v, %v for unpadded data", reread.Raw(), err)
+		} else if encoding != base64.RawStdEncoding && err == nil {
+			t.Errorf("expected the default decoder to reject %s", out)
+		}
+	}
+}
+
+func TestWriteFormatReal(t *testing.T) {
+	value := plist.Value{Value: []plist.Value{
+		{Value: 1.5, Type: plist.RealType},
+		{Value: 0.0, Type: plist.RealType},
+		{Value: -2.0004, Type: plist.RealType},
+	}, Type: plist.ArrayType}
+	out := encodeString(t, func(e *plist.Encoder) { e.FormatReal = plist.FixedReal(3) }, value)
+	for _, fragment := range []string{"<real>1.500</real>", "<real>0.000</real>", "<real>-2.000</real>"} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+	out = encodeString(t, func(e *plist.Encoder) {
+		e.FormatReal = func(f float64) string { return strconv.FormatFloat(f, 'e', 2, 64) }
+	}, value)
+	if !strings.Contains(out, "<real>1.50e+00</real>") {
+		t.Errorf("unexpected custom format:\n%s", out)
+	}
+
+	encoder := plist.NewEncoder(&bytes.Buffer{})
+	encoder.FormatReal = func(f float64) string { return strings.Replace(strconv.FormatFloat(f, 'f', 2, 64), ".", ",", 1) }
+	if err := encoder.Encode(value); err == nil {
+		t.Errorf("expected an error for an unreadable format")
+	}
+	encoder.FormatReal = func(f float64) string {
+		if f == -2.0004 {
+			return "about -2"
+		}
+		return "1"
+	}
+	if err, ok := encoder.Encode(value).(*plist.FormatError); !ok || err.Path != "2" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestWriteDateZone(t *testing.T) {
+	value := mustRead(t, `<plist><array><date>2023-06-01T09:00:00+02:00</date><date>2023-06-01T07:00:00Z</date></array></plist>`)
+	dates := value.Value.([]plist.Value)
+	if _, offset := dates[0].Value.(time.Time).Zone(); offset != 2*3600 {
+		t.Errorf("reader discarded the offset, got %d", offset)
+	}
+	out := encodeString(t, nil, value)
+	if strings.Count(out, "<date>2023-06-01T07:00:00Z</date>") != 2 {
+		t.Errorf("expected UTC dates by default:\n%s", out)
+	}
+	out = encodeString(t, func(e *plist.Encoder) { e.DateZone = plist.PreserveDates }, value)
+	if !strings.Contains(out, "<date>2023-06-01T09:00:00+02:00</date>") || !strings.Contains(out, "<date>2023-06-01T07:00:00Z</date>") {
+		t.Errorf("expected preserved offsets:\n%s", out)
+	}
+	out = encodeString(t, func(e *plist.Encoder) { e.DateZone = plist.LocalDates }, value)
+	local := dates[1].Value.(time.Time).Local().Format(time.RFC3339)
+	if strings.Count(out, "<date>"+local+"</date>") != 2 {
+		t.Errorf("expected local dates %s:\n%s", local, out)
+	}
+	out = encodeString(t, func(e *plist.Encoder) { e.DateZone = plist.PreserveDates; e.Canonical = true }, value)
+	if strings.Contains(out, "+02:00") {
+		t.Errorf("canonical output must use UTC:\n%s", out)
+	}
+}
+
+func TestWriteFormatHooks(t *testing.T) {
+	when := time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC)
+	value := plist.Value{Value: map[string]plist.Value{
+		"count": {Value: int64(42), Type: plist.IntegerType},
+		"when":  {Value: when, Type: plist.DateType},
+		"big":   {Value: uint64(math.MaxUint64), Type: plist.IntegerType},
+	}, Type: plist.DictType}
+	out := encodeString(t, func(e *plist.Encoder) {
+		e.FormatInteger = func(i int64) string { return fmt.Sprintf("%+05d", i) }
+		e.FormatDate = func(t time.Time) string { return t.Format("2006-01-02T15:04:05.000Z07:00") }
+	}, value)
+	for _, fragment := range []string{
+		"<integer>+0042</integer>",
+		"<date>2016-11-01T08:46:41.000Z</date>",
+		"<integer>18446744073709551615</integer>",
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	encoder.FormatDate = func(t time.Time) string { return t.Format(time.RFC1123) }
+	if err, ok := encoder.Encode(value).(*plist.FormatError); !ok || err.Value.Type != plist.DateType {
+		t.Errorf("unexpected error %v", err)
+	}
+	encoder.FormatDate = nil
+	encoder.FormatInteger = func(i int64) string {
+		if i == 42 {
+			return "<42>"
+		}
+		return strconv.FormatInt(i, 10)
+	}
+	if err, ok := encoder.Encode(value).(*plist.FormatError); !ok || err.Path != "count" || buffer.Len() != 0 {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func largeDict(n int) plist.Value {
+	m := make(map[string]plist.Value, n)
+	for i := 0; i < n; i++ {
+		m["key"+strconv.Itoa(i*7919%n)] = plist.Value{Value: int64(i), Type: plist.IntegerType}
+	}
+	return plist.Value{Value: m, Type: plist.DictType}
+}
+
+func TestKeyCache(t *testing.T) {
+	value := largeDict(100)
+	cache := &plist.KeyCache{}
+	cached := func(e *plist.Encoder) { e.KeyCache = cache }
+	expected := encodeString(t, nil, value)
+	for i := 0; i < 2; i++ {
+		if out := encodeString(t, cached, value); out != expected {
+			t.Fatalf("unexpected output with KeyCache:\n%s", out)
+		}
+	}
+
+	// Modifications keep the size of the dict but must not use stale keys.
+	m := value.Dict()
+	delete(m, "key1")
+	m["zzz"] = plist.Value{Value: true, Type: plist.BooleanType}
+	if out := encodeString(t, cached, value); out != encodeString(t, nil, value) {
+		t.Errorf("stale keys used after modifying the dict:\n%s", out)
+	}
+	insensitive := func(e *plist.Encoder) { e.KeyCache = cache; e.KeySort = plist.CaseInsensitiveSort }
+	m["Aaa"] = plist.Value{Value: false, Type: plist.BooleanType}
+	if out := encodeString(t, insensitive, value); !strings.Contains(out, "<dict>\n    <key>Aaa</key>") {
+		t.Errorf("keys cached for another KeySort used")
+	}
+	cache.Reset()
+	if out := encodeString(t, cached, value); out != encodeString(t, nil, value) {
+		t.Errorf("unexpected output after Reset:\n%s", out)
+	}
+}
+
+func BenchmarkKeyCache(b *testing.B) {
+	value := largeDict(20000)
+	for _, cache := range []*plist.KeyCache{nil, {}} {
+		name := "Sort"
+		if cache != nil {
+			name = "Cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			encoder := plist.NewEncoder(io.Discard)
+			encoder.KeyCache = cache
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := encoder.Encode(value); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func deterministicTree(seed int) plist.Value {
+	m := map[string]plist.Value{}
+	for i := 0; i < 50; i++ {
+		// Insert in a different order for every seed.
+		key := strconv.Itoa((i*31 + seed) % 50)
+		m[key] = plist.Value{Value: []plist.Value{
+			{Value: map[string]plist.Value{"b": {Value: 1.5, Type: plist.RealType}, "a": {Value: key, Type: plist.StringType}}, Type: plist.DictType},
+			{Value: []byte(key), Type: plist.DataType},
+		}, Type: plist.ArrayType}
+	}
+	return plist.Value{Value: m, Type: plist.DictType}
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	expected := encodeString(t, nil, deterministicTree(0))
+	for seed := 1; seed < 100; seed++ {
+		if out := encodeString(t, nil, deterministicTree(seed)); out != expected {
+			t.Fatalf("output differs for seed %d:\n%s", seed, out)
+		}
+	}
+}
+
+func TestWriteASCIIOnly(t *testing.T) {
+	texts := []string{"Üsér Diacriticà", "e\u0301", "smile 😀", "plain & <simple>"}
+	values := map[string]plist.Value{}
+	for _, s := range texts {
+		values[s] = plist.Value{Value: s, Type: plist.StringType}
+	}
+	value := plist.Value{Value: values, Type: plist.DictType}
+	out := encodeString(t, func(e *plist.Encoder) { e.ASCIIOnly = true }, value)
+	for _, r := range out {
+		if r > 0x7f {
+			t.Fatalf("output contains %q:\n%s", r, out)
+		}
+	}
+	for _, fragment := range []string{"<key>&#xDC;s&#xE9;r Diacritic&#xE0;</key>", "<string>e&#x301;</string>", "<key>smile &#x1F600;</key>"} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("unexpected value after a round trip: %v", reread.Raw())
+	}
+}
+
+func TestWriteComments(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"Settings": {Value: map[string]plist.Value{
+			"Timeout": {Value: int64(30), Type: plist.IntegerType},
+		}, Type: plist.DictType},
+		"Name": {Value: "x", Type: plist.StringType},
+	}, Type: plist.DictType}
+	comments := map[string]string{"Settings.Timeout": "In seconds", "Name": "Shown to users", "Missing": "unused"}
+	out := encodeString(t, func(e *plist.Encoder) { e.Comments = comments }, value)
+	for _, fragment := range []string{
+		"\n    <!-- Shown to users -->\n    <key>Name</key>",
+		"\n      <!-- In seconds -->\n      <key>Timeout</key>",
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %q:\n%s", fragment, out)
+		}
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("unexpected value after a round trip: %v", reread.Raw())
+	}
+	if out := encodeString(t, func(e *plist.Encoder) { e.Comments = comments; e.Canonical = true }, value); strings.Contains(out, "<!--") {
+		t.Errorf("canonical output must not carry comments:\n%s", out)
+	}
+
+	for _, text := range []string{"a -- b", "trailing-", "bad\x00"} {
+		encoder := plist.NewEncoder(io.Discard)
+		encoder.Comments = map[string]string{"Name": text}
+		if err := encoder.Encode(value); err == nil {
+			t.Errorf("expected an error for comment %q", text)
+		}
+	}
+
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	encoder.Comments = comments
+	if err := encoder.BeginDict(); err != nil {
+		t.Fatal(err)
+	}
+	encoder.Key("Name")
+	encoder.Scalar(plist.Value{Value: "x", Type: plist.StringType})
+	encoder.EndDict()
+	if err := encoder.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), "<!-- Shown to users -->\n    <key>Name</key>") {
+		t.Errorf("streamed output lacks the comment:\n%s", buffer.String())
+	}
+}
+
+func TestWriteRecordedComments(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(commentedDocument))
+	decoder.KeepComments = true
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	value.Value.(map[string]plist.Value)["Name"] = plist.Value{Value: "changed", Type: plist.StringType}
+	out := encodeString(t, func(e *plist.Encoder) {
+		e.Metadata = decoder.Metadata()
+		e.Comments = map[string]string{"Items": "Overridden"}
+	}, value)
+	for _, fragment := range []string{
+		"<plist version=\"1.0\">\n  <!-- before the root -->\n  <dict>",
+		"\n    <!-- Overridden -->\n    <key>Items</key>",
+		"\n    <array>\n      <!-- first -->\n      <integer>1</integer>",
+		"<integer>2</integer>\n      <!-- trailing in array -->\n    </array>",
+		"\n    <!-- trailing in dict -->\n  </dict>",
+		"\n    <!-- Shown to users\n    between key and value -->\n    <key>Name</key>",
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %q:\n%s", fragment, out)
+		}
+	}
+	out = encodeString(t, func(e *plist.Encoder) {
+		e.Comments = map[string]string{"Name": "first\n\t\tsecond"}
+		e.Compact = true
+	}, value)
+	if !strings.Contains(out, "<!-- first second --><key>Name</key>") {
+		t.Errorf("expected a single line comment:\n%s", out)
+	}
+
+	// Streamed documents carry them as well, even in otherwise empty
+	// containers.
+	metadata := decoder.Metadata()
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	encoder.Metadata = metadata
+	encoder.BeginDict()
+	encoder.Key("Items")
+	encoder.BeginArray()
+	encoder.EndArray()
+	encoder.EndDict()
+	if err := encoder.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	for _, fragment := range []string{"<!-- before the root -->", "<array>\n      <!-- trailing in array -->\n    </array>", "<!-- trailing in dict -->\n  </dict>"} {
+		if !strings.Contains(buffer.String(), fragment) {
+			t.Errorf("streamed output lacks %q:\n%s", fragment, buffer.String())
+		}
+	}
+	if out := encodeString(t, func(e *plist.Encoder) { e.Metadata = decoder.Metadata(); e.Canonical = true }, value); strings.Contains(out, "<!--") {
+		t.Errorf("canonical output must not carry comments:\n%s", out)
+	}
+}
+
+func TestEncoderProgress(t *testing.T) {
+	records := make([]plist.Value, 500)
+	for i := range records {
+		records[i] = appendRecord(int64(i))
+	}
+	value := plist.Value{Value: records, Type: plist.ArrayType}
+	var reports []int64
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	encoder.Progress = func(written int64) { reports = append(reports, written) }
+	if err := encoder.Encode(value); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if len(reports) < 2 || reports[len(reports)-1] != int64(buffer.Len()) {
+		t.Fatalf("unexpected reports %v for %d bytes", reports, buffer.Len())
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i] <= reports[i-1] {
+			t.Errorf("reports do not increase: %v", reports)
+		}
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	value := plist.Value{Value: []plist.Value{appendRecord(1), appendRecord(2)}, Type: plist.ArrayType}
+	if n, err := value.EncodedSize(plist.XMLFormat); err != nil || n != len(encodeString(t, nil, value)) {
+		t.Errorf("unexpected size %d, %v", n, err)
+	}
+	if _, err := value.EncodedSize(plist.BinaryFormat); err == nil {
+		t.Errorf("expected an error for the binary format")
+	}
+	if _, err := (plist.Value{Value: math.NaN(), Type: plist.RealType}).EncodedSize(plist.XMLFormat); err == nil {
+		t.Errorf("expected an error for NaN")
+	}
+}
+
+// cancelWriter cancels its context once more than limit bytes were written.
+type cancelWriter struct {
+	bytes.Buffer
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (self *cancelWriter) Write(p []byte) (int, error) {
+	if self.Len() > self.limit {
+		self.cancel()
+	}
+	return self.Buffer.Write(p)
+}
+
+func TestEncodeContext(t *testing.T) {
+	records := make([]plist.Value, 2000)
+	for i := range records {
+		records[i] = appendRecord(int64(i))
+	}
+	value := plist.Value{Value: records, Type: plist.ArrayType}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := &cancelWriter{limit: 8192, cancel: cancel}
+	if err := value.WriteContext(ctx, writer); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if full := len(encodeString(t, nil, value)); writer.Len() >= full {
+		t.Errorf("expected a partial document, got %d of %d bytes", writer.Len(), full)
+	}
+
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	if err := encoder.EncodeContext(ctx, value); !errors.Is(err, context.Canceled) || buffer.Len() != 0 {
+		t.Errorf("expected context.Canceled without output, got %v and %d bytes", err, buffer.Len())
+	}
+	if err := encoder.EncodeContext(context.Background(), value); err != nil || buffer.String() != encodeString(t, nil, value) {
+		t.Errorf("unexpected result after a cancelled document: %v", err)
+	}
+}
+
+func TestWriteCDATA(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"markup": {Value: `<a href="x">y</a>`, Type: plist.StringType},
+		"split":  {Value: "<x>]]></x>", Type: plist.StringType},
+		"plain":  {Value: "plain text & more", Type: plist.StringType},
+		"return": {Value: "<a>\r</a>", Type: plist.StringType},
+		"accent": {Value: "<é>", Type: plist.StringType},
+	}, Type: plist.DictType}
+	out := encodeString(t, func(e *plist.Encoder) { e.CDATAThreshold = 0.2 }, value)
+	for _, fragment := range []string{
+		`<string><![CDATA[<a href="x">y</a>]]></string>`,
+		`<string><![CDATA[<x>]]]]><![CDATA[></x>]]></string>`,
+		`<string>plain text &amp; more</string>`,
+		`<string>&lt;a&gt;&#13;&lt;/a&gt;</string>`,
+		`<string><![CDATA[<é>]]></string>`,
+	} {
+		if !strings.Contains(out, fragment) {
+			t.Errorf("output lacks %s:\n%s", fragment, out)
+		}
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("unexpected round trip result %q", reread.Raw())
+	}
+
+	out = encodeString(t, func(e *plist.Encoder) { e.CDATAThreshold = 0.2; e.ASCIIOnly = true }, value)
+	if !strings.Contains(out, `<string>&lt;&#xE9;&gt;</string>`) {
+		t.Errorf("expected escaped ASCII output:\n%s", out)
+	}
+	if out := encodeString(t, nil, value); strings.Contains(out, "CDATA") {
+		t.Errorf("unexpected CDATA by default:\n%s", out)
+	}
+	encoder := plist.NewEncoder(io.Discard)
+	encoder.CDATAThreshold = 1.5
+	if err := encoder.Encode(value); err == nil {
+		t.Errorf("expected an error for an invalid CDATAThreshold")
+	}
+}
+
+func TestWritePipeClosed(t *testing.T) {
+	values := make([]plist.Value, 100000)
+	for i := range values {
+		values[i] = plist.Value{Value: int64(i), Type: plist.IntegerType}
+	}
+	value := plist.Value{Value: values, Type: plist.ArrayType}
+	closed := errors.New("reader gone")
+	for name, write := range map[string]func(io.Writer) error{
+		"Write": value.Write,
+		"WriteTo": func(writer io.Writer) error {
+			_, err := value.WriteTo(writer)
+			return err
+		},
+		"Encode": func(writer io.Writer) error {
+			// The hook counts the integers checked before and written while
+			// writing.
+			calls := 0
+			encoder := plist.NewEncoder(writer)
+			encoder.FormatInteger = func(i int64) string {
+				calls++
+				return strconv.FormatInt(i, 10)
+			}
+			err := encoder.Encode(value)
+			if calls >= 2*len(values) {
+				t.Errorf("Encode formatted %d integers after the error", calls-len(values))
+			}
+			return err
+		},
+	} {
+		reader, writer := io.Pipe()
+		go func() {
+			io.CopyN(io.Discard, reader, 10000)
+			reader.CloseWithError(closed)
+		}()
+		result := make(chan error, 1)
+		go func() { result <- write(writer) }()
+		select {
+		case err := <-result:
+			if !errors.Is(err, closed) {
+				t.Errorf("%s: expected the error of the reader, got %v", name, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s did not return after the reader closed", name)
+		}
+	}
+}
+
+func BenchmarkEncodeContext(b *testing.B) {
+	records := make([]plist.Value, 1000)
+	for i := range records {
+		records[i] = appendRecord(int64(i))
+	}
+	value := plist.Value{Value: records, Type: plist.ArrayType}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	encoder := plist.NewEncoder(io.Discard)
+	b.Run("Plain", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			encoder.Encode(value)
+		}
+	})
+	b.Run("Context", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			encoder.EncodeContext(ctx, value)
+		}
+	})
+}
+
+func TestWriteCarriageReturns(t *testing.T) {
+	texts := []string{"a\rb", "line\r\nbreak", "\r", "tab\tand\nnewline"}
+	values := map[string]plist.Value{}
+	for _, s := range texts {
+		values[s] = plist.Value{Value: s, Type: plist.StringType}
+	}
+	value := plist.Value{Value: values, Type: plist.DictType}
+	out := encodeString(t, nil, value)
+	if strings.Contains(out, "\r") || !strings.Contains(out, "<string>line&#13;&#xA;break</string>") {
+		t.Errorf("carriage returns must be written as references:\n%q", out)
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("strings changed by a round trip: %q", reread.Raw())
+	}
+	// The hexadecimal spelling reads the same.
+	if value := mustRead(t, "<plist><string>a&#xD;b</string></plist>"); value.Value != "a\rb" {
+		t.Errorf("unexpected value %q", value.Value)
+	}
+}
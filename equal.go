@@ -0,0 +1,159 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bytes"
+	"math"
+	"time"
+)
+
+func realsEqual(a, b float64) bool {
+	return a == b && math.Signbit(a) == math.Signbit(b) || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+// Equal reports whether both values hold the same data. Dicts compare
+// independent of key order and of being held as map or *OrderedDict, dates
+// compare with time.Time.Equal, NaN reals equal each other and negative zero
+// differs from zero, as it does in the written document.
+func (self Value) Equal(other Value) bool {
+	if self.Type != other.Type {
+		return false
+	}
+	switch self.Type {
+	case ArrayType:
+		a, b := self.Value.([]Value), other.Value.([]Value)
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !a[i].Equal(b[i]) {
+				return false
+			}
+		}
+		return true
+	case DictType:
+		a, b := self.dictMap(), other.dictMap()
+		if len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !v.Equal(w) {
+				return false
+			}
+		}
+		return true
+	case IntegerType:
+		ai, au, _ := self.integer()
+		bi, bu, _ := other.integer()
+		return ai == bi && au == bu
+	case RealType:
+		return realsEqual(self.Value.(float64), other.Value.(float64))
+	case DataType:
+		return bytes.Equal(self.data(), other.data())
+	case DateType:
+		return self.Value.(time.Time).Equal(other.Value.(time.Time))
+	case InvalidType:
+		return true
+	}
+	return self.Value == other.Value
+}
+
+// rawInteger converts the Go integer types to int64.
+func rawInteger(raw interface{}) (int64, bool) {
+	switch i := raw.(type) {
+	case int:
+		return int64(i), true
+	case int8:
+		return int64(i), true
+	case int16:
+		return int64(i), true
+	case int32:
+		return int64(i), true
+	case int64:
+		return i, true
+	case uint8:
+		return int64(i), true
+	case uint16:
+		return int64(i), true
+	case uint32:
+		return int64(i), true
+	case uint:
+		return int64(i), i <= math.MaxInt64
+	case uint64:
+		return int64(i), i <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// EqualRaw reports whether the value equals raw, a native structure of the kind
+// returned by Raw, using the same semantics as Equal. For convenience in
+// literals integers may be of any Go integer type and reals float32.
+func (self Value) EqualRaw(raw interface{}) bool {
+	switch self.Type {
+	case ArrayType:
+		values := self.Value.([]Value)
+		r, ok := raw.([]interface{})
+		if !ok || len(r) != len(values) {
+			return false
+		}
+		for i := range values {
+			if !values[i].EqualRaw(r[i]) {
+				return false
+			}
+		}
+		return true
+	case DictType:
+		m := self.dictMap()
+		r, ok := raw.(map[string]interface{})
+		if !ok || len(r) != len(m) {
+			return false
+		}
+		for k, v := range m {
+			if w, ok := r[k]; !ok || !v.EqualRaw(w) {
+				return false
+			}
+		}
+		return true
+	case IntegerType:
+		if i, u, large := self.integer(); large {
+			switch r := raw.(type) {
+			case uint64:
+				return r == u
+			case uint:
+				return uint64(r) == u
+			}
+			return false
+		} else {
+			r, ok := rawInteger(raw)
+			return ok && r == i
+		}
+	case RealType:
+		switch f := raw.(type) {
+		case float64:
+			return realsEqual(self.Value.(float64), f)
+		case float32:
+			return realsEqual(self.Value.(float64), float64(f))
+		}
+		return false
+	case DataType:
+		b, ok := raw.([]byte)
+		return ok && bytes.Equal(self.data(), b)
+	case DateType:
+		t, ok := raw.(time.Time)
+		return ok && self.Value.(time.Time).Equal(t)
+	case StringType:
+		s, ok := raw.(string)
+		return ok && s == self.Value.(string)
+	case BooleanType:
+		b, ok := raw.(bool)
+		return ok && b == self.Value.(bool)
+	case UIDType:
+		u, ok := raw.(UID)
+		return ok && u == self.Value.(UID)
+	case NullType:
+		return raw == nil
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestEqual(t *testing.T) {
+	plain := mustRead(t, orderedDocument)
+	ordered := decodeOrdered(t, orderedDocument)
+	if !plain.Equal(ordered) || !ordered.Equal(plain) {
+		t.Errorf("ordered and plain dicts must be equal")
+	}
+	when := time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC)
+	a := plist.Value{Value: when, Type: plist.DateType}
+	b := plist.Value{Value: when.In(time.FixedZone("CET", 3600)), Type: plist.DateType}
+	if !a.Equal(b) {
+		t.Errorf("dates in different zones must be equal")
+	}
+	nan := plist.Value{Value: math.NaN(), Type: plist.RealType}
+	if !nan.Equal(nan) {
+		t.Errorf("NaN must equal NaN")
+	}
+	zero, negativeZero := plist.Value{Value: 0.0, Type: plist.RealType}, plist.Value{Value: math.Copysign(0, -1), Type: plist.RealType}
+	if zero.Equal(negativeZero) || zero.Hash() == negativeZero.Hash() {
+		t.Errorf("negative zero must differ from zero")
+	}
+	changed := mustRead(t, orderedDocument)
+	changed.Value.(map[string]plist.Value)["middle"] = plist.Value{Value: "x", Type: plist.StringType}
+	if plain.Equal(changed) {
+		t.Errorf("different dicts must not be equal")
+	}
+	if plain.Equal(plist.Value{Value: "zeta", Type: plist.StringType}) {
+		t.Errorf("values of different types must not be equal")
+	}
+}
+
+func TestEqualRaw(t *testing.T) {
+	value := mustRead(t, orderedDocument)
+	expected := map[string]interface{}{
+		"zeta":   1,
+		"alpha":  map[string]interface{}{"first": false, "second": true},
+		"middle": "m",
+	}
+	if !value.EqualRaw(expected) {
+		t.Errorf("value must equal %v", expected)
+	}
+	if !value.EqualRaw(value.Raw()) {
+		t.Errorf("value must equal its Raw form")
+	}
+	expected["zeta"] = int64(2)
+	if value.EqualRaw(expected) {
+		t.Errorf("value must not equal %v", expected)
+	}
+	expected["zeta"] = "1"
+	if value.EqualRaw(expected) {
+		t.Errorf("integer must not equal a string")
+	}
+	array := plist.Value{Value: []plist.Value{
+		{Value: 1.5, Type: plist.RealType},
+		{Value: []byte("x"), Type: plist.DataType},
+	}, Type: plist.ArrayType}
+	if !array.EqualRaw([]interface{}{float32(1.5), []byte("x")}) {
+		t.Errorf("array must equal its raw form")
+	}
+	if array.EqualRaw([]interface{}{1.5}) {
+		t.Errorf("arrays of different lengths must not be equal")
+	}
+}
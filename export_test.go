@@ -0,0 +1,7 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+// AppendArray exposes appendArray to tests with files failing on demand.
+var AppendArray = appendArray
@@ -0,0 +1,128 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Extract returns the value at the key path of the plist document in reader,
+// like Query on the decoded document, see Decoder.Extract.
+func Extract(reader io.Reader, path string) (Value, error) {
+	value, err := NewDecoder(reader).Extract(path)
+	if err == io.EOF {
+		return InvalidValue, plistErrorFromString(0, "No plist element found")
+	}
+	return value, err
+}
+
+// Extract returns the value at the key path of the next document of the
+// input, like Query on the decoded document. Only that value is decoded: the
+// values before it are skipped without being converted, and reading stops
+// once it is complete, so neither the rest of the document nor following
+// documents are checked and the Decoder cannot read them. A dict holding the
+// key more than once yields the first value. The dicts and arrays leading to
+// the value count toward MaxDepth. io.EOF is returned when the input holds no
+// further document.
+func (self *Decoder) Extract(path string) (Value, error) {
+	self.init()
+	self.reset()
+	if err := self.readPrologue(); err != nil {
+		return InvalidValue, err
+	}
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, pathSeparator)
+	}
+	return self.extract(segments)
+}
+
+// extract reads the value at the key path segments below the next element.
+func (self *Decoder) extract(segments []string) (Value, error) {
+	element, err := self.nextElement()
+	if err != nil {
+		return InvalidValue, err
+	} else if element == nil {
+		return InvalidValue, plistErrorFromString(self.inputOffset(), "Plist element has no value")
+	}
+	for i, segment := range segments {
+		switch element.Name.Local {
+		case "dict":
+			if err = self.enter(); err == nil {
+				element, err = self.extractEntry(segment)
+			}
+		case "array":
+			if err = self.enter(); err == nil {
+				element, err = self.extractElement(segment)
+			}
+		case "true", "false":
+			err = fmt.Errorf("Cannot look up %q in boolean at %q", segment, joinPath(segments[:i]))
+		default:
+			err = fmt.Errorf("Cannot look up %q in %s at %q", segment, element.Name.Local, joinPath(segments[:i]))
+		}
+		if err != nil {
+			return InvalidValue, withOffset(self.inputOffset(), err)
+		}
+		self.path = append(self.path, segment)
+	}
+	return self.parseElement(*element)
+}
+
+// extractEntry returns the value element of key in the dict being read,
+// skipping the entries before it.
+func (self *Decoder) extractEntry(key string) (*xml.StartElement, error) {
+	for {
+		element, err := self.nextElement()
+		if err != nil {
+			return nil, err
+		} else if element == nil {
+			return nil, fmt.Errorf("No key %q at %q", key, joinPath(self.path))
+		} else if element.Name.Local != "key" {
+			return nil, fmt.Errorf("Expected key, found %s", element.Name.Local)
+		}
+		text, err := self.elementText(*element)
+		if err != nil {
+			return nil, err
+		}
+		original := text
+		if self.KeyTransform != nil {
+			text = self.KeyTransform(text)
+		}
+		value, err := self.nextElement()
+		if err != nil {
+			return nil, err
+		} else if value == nil || value.Name.Local == "key" {
+			return nil, fmt.Errorf("Key %q has no value", original)
+		} else if text == key {
+			return value, nil
+		} else if err := self.decoder.Skip(); err != nil {
+			return nil, plistErrorFromError(self.inputOffset(), err)
+		}
+	}
+}
+
+// extractElement returns the element at index in the array being read,
+// skipping the elements before it.
+func (self *Decoder) extractElement(index string) (*xml.StartElement, error) {
+	n, err := strconv.Atoi(index)
+	if err != nil {
+		n = -1
+	}
+	for count := 0; ; count++ {
+		element, err := self.nextElement()
+		if err != nil {
+			return nil, err
+		} else if element == nil {
+			return nil, fmt.Errorf("No index %q in array of %d at %q", index, count, joinPath(self.path))
+		} else if count == n {
+			return element, nil
+		} else if err := self.decoder.Skip(); err != nil {
+			return nil, plistErrorFromError(self.inputOffset(), err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+const extractDocument = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict>
+	<key>Skipped</key><dict><key>Broken</key><integer>not a number</integer></dict>
+	<key>Payloads</key><array>
+		<dict><key>PayloadType</key><string>first</string></dict>
+		<dict><key>PayloadType</key><string>second</string><key>Blob</key><data>AAE=</data></dict>
+	</array>
+	<key>Name</key><string>x</string>
+</dict></plist>`
+
+func TestExtract(t *testing.T) {
+	for path, expected := range map[string]plist.Value{
+		"Payloads.1.PayloadType": {Value: "second", Type: plist.StringType},
+		"Payloads.1.Blob":        {Value: []byte{0, 1}, Type: plist.DataType},
+		"Name":                   {Value: "x", Type: plist.StringType},
+		"Payloads.0": {Value: map[string]plist.Value{
+			"PayloadType": {Value: "first", Type: plist.StringType},
+		}, Type: plist.DictType},
+	} {
+		value, err := plist.Extract(strings.NewReader(extractDocument), path)
+		if err != nil || !value.Equal(expected) {
+			t.Errorf("unexpected result %v, %v at %q", value.Raw(), err, path)
+		}
+	}
+
+	// Skipped values are not converted and the rest is not read.
+	if _, err := plist.Read(strings.NewReader(extractDocument)); err == nil {
+		t.Errorf("expected Read to fail on the skipped value")
+	}
+	truncated := extractDocument[:strings.Index(extractDocument, "<key>Name")]
+	if value, err := plist.Extract(strings.NewReader(truncated), "Payloads.0.PayloadType"); err != nil || value.Value != "first" {
+		t.Errorf("unexpected result %v, %v for a truncated document", value, err)
+	}
+
+	root, err := plist.Extract(strings.NewReader(`<plist><array><true/></array></plist>`), "")
+	if err != nil || root.Type != plist.ArrayType {
+		t.Errorf("unexpected root %v, %v", root, err)
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	for path, message := range map[string]string{
+		"Missing":                  `No key "Missing" at ""`,
+		"Payloads.2":               `No index "2" in array of 2 at "Payloads"`,
+		"Payloads.first":           `No index "first" in array of 2 at "Payloads"`,
+		"Name.x":                   `Cannot look up "x" in string at "Name"`,
+		"Skipped.Broken":           `not a number`,
+		"Payloads.0.PayloadType.x": `Cannot look up "x" in string at "Payloads.0.PayloadType"`,
+	} {
+		if _, err := plist.Extract(strings.NewReader(extractDocument), path); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected an error containing %q at %q, got %v", message, path, err)
+		}
+	}
+	if _, err := plist.Extract(strings.NewReader(""), ""); err == nil {
+		t.Errorf("expected an error for an empty input")
+	}
+}
+
+func TestDecoderExtract(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(extractDocument))
+	decoder.KeyTransform = strings.ToLower
+	value, err := decoder.Extract("payloads.1.payloadtype")
+	if err != nil || value.Value != "second" {
+		t.Errorf("unexpected result %v, %v", value, err)
+	}
+
+	// The dict, array and dict leading to the string count toward MaxDepth.
+	for depth, ok := range map[int]bool{2: false, 3: true} {
+		decoder := plist.NewDecoder(strings.NewReader(extractDocument))
+		decoder.MaxDepth = depth
+		_, err := decoder.Extract("Payloads.1.PayloadType")
+		if ok && err != nil || !ok && !errors.Is(err, plist.ErrTooDeep) {
+			t.Errorf("unexpected error %v for MaxDepth %d", err, depth)
+		}
+	}
+
+	if _, err := plist.NewDecoder(strings.NewReader(" ")).Extract("a"); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	if _, err := plist.Extract(strings.NewReader(`<plist><dict><key>a</key><key>b</key><true/></dict></plist>`), "b"); err == nil || !strings.Contains(err.Error(), `Key "a" has no value`) {
+		t.Errorf("unexpected error %v for a key without value", err)
+	}
+}
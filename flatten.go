@@ -0,0 +1,180 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scalarString returns the textual form of a scalar value as used by Flatten.
+func (self Value) scalarString() string {
+	switch self.Type {
+	case StringType:
+		return self.Value.(string)
+	case IntegerType:
+		return self.formatInteger(10)
+	case UIDType:
+		return strconv.FormatUint(uint64(self.Value.(UID)), 10)
+	case RealType:
+		return strconv.FormatFloat(self.Value.(float64), 'g', -1, 64)
+	case BooleanType:
+		return strconv.FormatBool(self.Value.(bool))
+	case DateType:
+		return self.Value.(time.Time).UTC().Format(time.RFC3339)
+	case DataType:
+		return base64.StdEncoding.EncodeToString(self.data())
+	}
+	return ""
+}
+
+// Flatten flattens the tree into key/value pairs suitable for environment
+// variables. The keys are the dict keys and array indices leading to each
+// scalar joined with sep, e.g. "KEY_SUBKEY_0" for sep "_". Scalars are
+// stringified: integers and reals in their shortest decimal form, booleans as
+// "true" or "false", dates as RFC 3339 in UTC and data as standard base64.
+// Empty dicts and arrays produce no entries, a scalar root is stored under
+// the empty key.
+func (self Value) Flatten(sep string) map[string]string {
+	result := map[string]string{}
+	self.flatten("", sep, result)
+	return result
+}
+
+func (self Value) flatten(prefix, sep string, result map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + sep + key
+	}
+	switch self.Type {
+	case DictType:
+		for k, v := range self.dictMap() {
+			v.flatten(join(k), sep, result)
+		}
+	case ArrayType:
+		for i, v := range self.Value.([]Value) {
+			v.flatten(join(strconv.Itoa(i)), sep, result)
+		}
+	case InvalidType:
+	default:
+		result[prefix] = self.scalarString()
+	}
+}
+
+type flatNode struct {
+	leaf     *string
+	children map[string]*flatNode
+}
+
+// Unflatten rebuilds a tree from pairs as produced by Flatten. Keys are split
+// at sep; nodes whose child segments are exactly the indices 0 to n-1 become
+// arrays, all other nodes become dicts. Leaf values are inferred as integer
+// when they parse as a base 10 int64, as real when they parse as a finite
+// float64, as boolean when they are "true" or "false" and as string
+// otherwise. Dates and data are not inferred and stay strings.
+// An error is returned when a key is both a leaf and a prefix of other keys.
+func Unflatten(m map[string]string, sep string) (Value, error) {
+	if sep == "" {
+		return InvalidValue, fmt.Errorf("Unflatten requires a separator")
+	}
+	root := &flatNode{}
+	for key, value := range m {
+		node := root
+		if key != "" {
+			for _, segment := range strings.Split(key, sep) {
+				if node.children == nil {
+					node.children = map[string]*flatNode{}
+				}
+				child, ok := node.children[segment]
+				if !ok {
+					child = &flatNode{}
+					node.children[segment] = child
+				}
+				node = child
+			}
+		}
+		value := value
+		node.leaf = &value
+	}
+	return root.value("", sep)
+}
+
+func isIndex(segment string) bool {
+	if segment == "" || (len(segment) > 1 && segment[0] == '0') {
+		return false
+	}
+	for _, c := range segment {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func inferScalar(s string) Value {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Value{i, IntegerType}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return Value{f, RealType}
+	}
+	if s == "true" || s == "false" {
+		return Value{s == "true", BooleanType}
+	}
+	return Value{s, StringType}
+}
+
+func (self *flatNode) value(key, sep string) (Value, error) {
+	if self.leaf != nil {
+		if len(self.children) > 0 {
+			return InvalidValue, fmt.Errorf("Key %q is both a value and a prefix", key)
+		}
+		return inferScalar(*self.leaf), nil
+	}
+	array := len(self.children) > 0
+	for segment := range self.children {
+		if !isIndex(segment) {
+			array = false
+			break
+		}
+		if index, _ := strconv.Atoi(segment); index >= len(self.children) {
+			array = false
+			break
+		}
+	}
+	if array {
+		result := make([]Value, len(self.children))
+		for segment, child := range self.children {
+			index, _ := strconv.Atoi(segment)
+			value, err := child.value(joinFlatKey(key, segment, sep), sep)
+			if err != nil {
+				return InvalidValue, err
+			}
+			result[index] = value
+		}
+		return Value{result, ArrayType}, nil
+	}
+	result := make(map[string]Value, len(self.children))
+	for segment, child := range self.children {
+		value, err := child.value(joinFlatKey(key, segment, sep), sep)
+		if err != nil {
+			return InvalidValue, err
+		}
+		result[segment] = value
+	}
+	return Value{result, DictType}, nil
+}
+
+func joinFlatKey(key, segment, sep string) string {
+	if key == "" {
+		return segment
+	}
+	return key + sep + segment
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+const flattenDocument = `<plist version="1.0">
+<dict>
+	<key>SERVER</key><dict>
+		<key>HOST</key><string>example.com</string>
+		<key>PORT</key><integer>8080</integer>
+		<key>TLS</key><true/>
+	</dict>
+	<key>PATHS</key><array>
+		<string>/usr/bin</string>
+		<dict><key>DIR</key><string>/opt</string></dict>
+	</array>
+	<key>RATIO</key><real>0.5</real>
+	<key>SINCE</key><date>2016-11-01T08:46:41Z</date>
+	<key>KEY</key><data>AAEC</data>
+	<key>EMPTY</key><dict/>
+</dict>
+</plist>`
+
+func TestFlatten(t *testing.T) {
+	expected := map[string]string{
+		"SERVER_HOST": "example.com",
+		"SERVER_PORT": "8080",
+		"SERVER_TLS":  "true",
+		"PATHS_0":     "/usr/bin",
+		"PATHS_1_DIR": "/opt",
+		"RATIO":       "0.5",
+		"SINCE":       "2016-11-01T08:46:41Z",
+		"KEY":         "AAEC",
+	}
+	if flat := mustRead(t, flattenDocument).Flatten("_"); !reflect.DeepEqual(flat, expected) {
+		t.Errorf("unexpected result %v", flat)
+	}
+}
+
+func TestFlattenScalarRoot(t *testing.T) {
+	flat := mustRead(t, `<plist version="1.0"><integer>7</integer></plist>`).Flatten(".")
+	if !reflect.DeepEqual(flat, map[string]string{"": "7"}) {
+		t.Errorf("unexpected result %v", flat)
+	}
+}
+
+func TestUnflattenRoundTrip(t *testing.T) {
+	value := mustRead(t, flattenDocument)
+	rebuilt, err := plist.Unflatten(value.Flatten("_"), "_")
+	if err != nil {
+		t.Fatalf("Unflatten failed: %s", err)
+	}
+	flat := rebuilt.Raw().(map[string]interface{})
+	server := flat["SERVER"].(map[string]interface{})
+	if server["PORT"] != int64(8080) || server["TLS"] != true || server["HOST"] != "example.com" {
+		t.Errorf("unexpected SERVER %v", server)
+	}
+	paths := flat["PATHS"].([]interface{})
+	if len(paths) != 2 || paths[0] != "/usr/bin" || paths[1].(map[string]interface{})["DIR"] != "/opt" {
+		t.Errorf("unexpected PATHS %v", paths)
+	}
+	if flat["RATIO"] != 0.5 || flat["SINCE"] != "2016-11-01T08:46:41Z" {
+		t.Errorf("unexpected scalars %v", flat)
+	}
+}
+
+func TestUnflattenSparseIndices(t *testing.T) {
+	value, err := plist.Unflatten(map[string]string{"LIST_0": "a", "LIST_2": "c"}, "_")
+	if err != nil {
+		t.Fatalf("Unflatten failed: %s", err)
+	}
+	list := value.Raw().(map[string]interface{})["LIST"]
+	if !reflect.DeepEqual(list, map[string]interface{}{"0": "a", "2": "c"}) {
+		t.Errorf("sparse indices must produce a dict, got %v", list)
+	}
+}
+
+func TestUnflattenConflict(t *testing.T) {
+	if _, err := plist.Unflatten(map[string]string{"A": "1", "A_B": "2"}, "_"); err == nil {
+		t.Errorf("expected an error for a key which is both leaf and prefix")
+	}
+	if _, err := plist.Unflatten(map[string]string{"A": "1"}, ""); err == nil {
+		t.Errorf("expected an error for an empty separator")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// RealFormat returns the text written for a finite real.
+type RealFormat func(f float64) string
+
+// FixedReal returns a RealFormat writing reals with precision decimal places,
+// e.g. "1.500" for a precision of 3.
+func FixedReal(precision int) RealFormat {
+	return func(f float64) string {
+		return strconv.FormatFloat(f, 'f', precision, 64)
+	}
+}
+
+// FormatError reports text of a Format hook of WriteOptions which cannot be
+// read back.
+type FormatError struct {
+	// Path is the key path of the value, empty when found by validating the
+	// options.
+	Path  string
+	Value Value
+	Text  string
+}
+
+func (self *FormatError) Error() string {
+	return fmt.Sprintf("Format hook wrote unreadable %s %q at %q", self.Value.Type.Name(), self.Text, self.Path)
+}
+
+// formatSamples are formatted to validate the Format hooks.
+var formatSamples = []Value{
+	{0.0, RealType}, {1.0, RealType}, {-1.5, RealType}, {0.001, RealType}, {-1e10, RealType},
+	{int64(0), IntegerType}, {int64(-42), IntegerType}, {int64(math.MaxInt64), IntegerType},
+	{time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC), DateType},
+}
+
+func (self *WriteOptions) checkFormatSamples() error {
+	for _, sample := range formatSamples {
+		if err := self.checkFormat(nil, sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookText returns the text of value written by a Format hook, if any.
+func (self *WriteOptions) hookText(value Value) (string, bool) {
+	if self.Canonical {
+		return "", false
+	}
+	switch value.Type {
+	case RealType:
+		if f := value.Value.(float64); self.FormatReal != nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return self.FormatReal(f), true
+		}
+	case DateType:
+		if self.FormatDate != nil {
+			return self.FormatDate(value.Value.(time.Time)), true
+		}
+	case IntegerType:
+		if i, _, large := value.integer(); self.FormatInteger != nil && !large {
+			return self.FormatInteger(i), true
+		}
+	}
+	return "", false
+}
+
+// checkFormat returns a *FormatError if a Format hook turns value into text
+// which the reader cannot parse.
+func (self *WriteOptions) checkFormat(path []string, value Value) error {
+	text, ok := self.hookText(value)
+	if !ok {
+		return nil
+	}
+	if _, err := (&Decoder{}).scalarFilter(value.Type.Name())(text); err != nil {
+		return &FormatError{Path: joinPath(path), Value: value, Text: text}
+	}
+	return nil
+}
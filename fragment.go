@@ -0,0 +1,63 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// WriteFragment writes only the element of the value, without XML
+// declaration, DOCTYPE and plist element, for embedding in other XML
+// documents. The first line is indented to options.FragmentDepth, following
+// lines as if nested that deep, and no line break follows the last line.
+// Key paths of the options are relative to the value.
+func (self Value) WriteFragment(writer io.Writer, options WriteOptions) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+	if err := options.checkValue(self, nil); err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(writer)
+	fragment := newXmlWriter(buffered, &options)
+	fragment.depth = options.FragmentDepth
+	fragment.lineStart = true
+	if err := fragment.writeValue(self); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// ReadFragment parses a bare value element as written by WriteFragment.
+func ReadFragment(reader io.Reader) (Value, error) {
+	return NewDecoder(reader).DecodeFragment()
+}
+
+// DecodeFragment parses the next bare value element from the input, without
+// XML declaration, DOCTYPE and plist element. Text and comments before the
+// element are skipped. io.EOF is returned when the input holds no further
+// element.
+func (self *Decoder) DecodeFragment() (Value, error) {
+	self.init()
+	self.reset()
+	for {
+		token, err := self.decoder.Token()
+		if err == io.EOF {
+			return InvalidValue, err
+		} else if err != nil {
+			return InvalidValue, plistErrorFromError(self.inputOffset(), err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			return self.parseElement(token)
+		case xml.EndElement:
+			return InvalidValue, plistErrorFromError(self.inputOffset(), fmt.Errorf("Unexpected end of %s before a value", token.Name.Local))
+		case xml.Comment:
+			self.recordComment(token)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestWriteFragment(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"list": {Value: []plist.Value{{Value: "a & b", Type: plist.StringType}}, Type: plist.ArrayType},
+	}, Type: plist.DictType}
+	var buffer bytes.Buffer
+	if err := value.WriteFragment(&buffer, plist.WriteOptions{FragmentDepth: 1}); err != nil {
+		t.Fatalf("WriteFragment failed: %s", err)
+	}
+	expected := "  <dict>\n    <key>list</key>\n    <array>\n      <string>a &amp; b</string>\n    </array>\n  </dict>"
+	if buffer.String() != expected {
+		t.Errorf("unexpected fragment:\n%s", buffer.String())
+	}
+
+	// Spliced into a plist element at depth 1 the fragment reads back.
+	document := "<plist version=\"1.0\">\n" + buffer.String() + "\n</plist>"
+	full := encodeString(t, nil, value)
+	if document != strings.TrimSpace(full[strings.Index(full, "<plist"):]) {
+		t.Errorf("fragment does not match the document body:\n%s", document)
+	}
+	if reread := mustRead(t, document); !reread.Equal(value) {
+		t.Errorf("unexpected value %v", reread.Raw())
+	}
+
+	buffer.Reset()
+	if err := value.WriteFragment(&buffer, plist.WriteOptions{Compact: true}); err != nil || buffer.String() != "<dict><key>list</key><array><string>a &amp; b</string></array></dict>" {
+		t.Errorf("unexpected compact fragment %q, %v", buffer.String(), err)
+	}
+	if err := value.WriteFragment(&buffer, plist.WriteOptions{FragmentDepth: -1}); err == nil {
+		t.Errorf("expected an error for a negative depth")
+	}
+}
+
+func TestReadFragment(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"list": {Value: []plist.Value{{Value: "a & b", Type: plist.StringType}}, Type: plist.ArrayType},
+		"n":    {Value: int64(7), Type: plist.IntegerType},
+	}, Type: plist.DictType}
+	var buffer bytes.Buffer
+	if err := value.WriteFragment(&buffer, plist.WriteOptions{FragmentDepth: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if reread, err := plist.ReadFragment(&buffer); err != nil || !reread.Equal(value) {
+		t.Errorf("unexpected result %v, %v", reread.Raw(), err)
+	}
+
+	decoder := plist.NewDecoder(strings.NewReader("<!-- first --><string>a</string>\n<integer>2</integer> "))
+	for _, expected := range []interface{}{"a", int64(2)} {
+		if value, err := decoder.DecodeFragment(); err != nil || value.Value != expected {
+			t.Errorf("unexpected result %v, %v", value, err)
+		}
+	}
+	if _, err := decoder.DecodeFragment(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+
+	for _, fragment := range []string{"<plist><true/></plist>", "<integer>x</integer>", "<dict><key>a</key></dict>"} {
+		if _, err := plist.ReadFragment(strings.NewReader(fragment)); err == nil || err == io.EOF {
+			t.Errorf("expected an error for %q, got %v", fragment, err)
+		}
+	}
+}
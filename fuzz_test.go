@@ -0,0 +1,82 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func FuzzRead(f *testing.F) {
+	for _, seed := range []string{
+		orderedDocument,
+		flattenDocument,
+		`<plist version="1.0"><dict><key>a</key><array><true/><data>AAEC</data></array></dict></plist>`,
+		`<plist><dict><key><dict/></key><string/></dict></plist>`,
+		`<plist><integer>0x1F</integer></plist>`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Only panics are failures, errors are expected for most inputs.
+		plist.Read(bytes.NewReader(data))
+		plist.Validate(bytes.NewReader(data))
+	})
+}
+
+// xmlText reports whether s only holds characters XML documents can carry.
+func xmlText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0xFFFE || r == 0xFFFF || (r >= 0xD800 && r < 0xE000) {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("key", "value", int64(-131383), -14242424.342, true, []byte("data"), int64(1477990001))
+	f.Add("", "", int64(0), 0.0, false, []byte{}, int64(0))
+	f.Fuzz(func(t *testing.T, key, s string, i int64, r float64, b bool, d []byte, seconds int64) {
+		if !xmlText(key) || !xmlText(s) {
+			t.Skip()
+		}
+		// Keep dates within the four digit years RFC 3339 can express.
+		when := time.Unix(seconds%253402300799, 0).UTC()
+		if when.Year() < 1 {
+			t.Skip()
+		}
+		value := plist.Value{Value: map[string]plist.Value{
+			key: {Value: s, Type: plist.StringType},
+			"nested": {Value: []plist.Value{
+				{Value: i, Type: plist.IntegerType},
+				{Value: r, Type: plist.RealType},
+				{Value: b, Type: plist.BooleanType},
+				{Value: d, Type: plist.DataType},
+				{Value: when, Type: plist.DateType},
+			}, Type: plist.ArrayType},
+		}, Type: plist.DictType}
+
+		var buffer bytes.Buffer
+		encoder := plist.NewEncoder(&buffer)
+		encoder.NonFinite = plist.WriteNonFinite
+		if err := encoder.Encode(value); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+		reread, err := plist.Read(&buffer)
+		if err != nil {
+			t.Fatalf("Read failed: %s\n%s", err, buffer.String())
+		}
+		if !reread.Equal(value) {
+			t.Fatalf("round trip mismatch:\n%v\n%v", value.Raw(), reread.Raw())
+		}
+	})
+}
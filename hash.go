@@ -0,0 +1,80 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Hash returns a SHA-256 fingerprint of the value.
+// The fingerprint is computed over a canonical form of the tree: dict keys are
+// sorted, dates are normalized to UTC and reals use the shortest round-trip
+// formatting. Logically equal values therefore hash identically regardless of
+// map iteration order or the location of their dates.
+func (self Value) Hash() [32]byte {
+	digest := sha256.New()
+	self.writeHash(digest)
+	var sum [32]byte
+	digest.Sum(sum[:0])
+	return sum
+}
+
+func hashLength(digest hash.Hash, n int) {
+	var buf [binary.MaxVarintLen64]byte
+	digest.Write(buf[:binary.PutUvarint(buf[:], uint64(n))])
+}
+
+func hashString(digest hash.Hash, s string) {
+	hashLength(digest, len(s))
+	digest.Write([]byte(s))
+}
+
+func (self Value) writeHash(digest hash.Hash) {
+	digest.Write([]byte{byte(self.Type)})
+	switch self.Type {
+	case ArrayType:
+		values := self.Value.([]Value)
+		hashLength(digest, len(values))
+		for _, v := range values {
+			v.writeHash(digest)
+		}
+	case DictType:
+		m := self.dictMap()
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		hashLength(digest, len(keys))
+		for _, k := range keys {
+			hashString(digest, k)
+			m[k].writeHash(digest)
+		}
+	case StringType:
+		hashString(digest, self.Value.(string))
+	case IntegerType:
+		hashString(digest, self.formatInteger(10))
+	case RealType:
+		hashString(digest, strconv.FormatFloat(self.Value.(float64), 'g', -1, 64))
+	case DataType:
+		data := self.data()
+		hashLength(digest, len(data))
+		digest.Write(data)
+	case DateType:
+		hashString(digest, self.Value.(time.Time).UTC().Format(time.RFC3339Nano))
+	case UIDType:
+		hashString(digest, strconv.FormatUint(uint64(self.Value.(UID)), 10))
+	case BooleanType:
+		if self.Value.(bool) {
+			digest.Write([]byte{1})
+		} else {
+			digest.Write([]byte{0})
+		}
+	}
+}
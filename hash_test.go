@@ -0,0 +1,52 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func hashTestDict(when time.Time) plist.Value {
+	return plist.Value{Value: map[string]plist.Value{
+		"name":  {Value: "example", Type: plist.StringType},
+		"count": {Value: int64(3), Type: plist.IntegerType},
+		"ratio": {Value: 0.25, Type: plist.RealType},
+		"when":  {Value: when, Type: plist.DateType},
+		"items": {Value: []plist.Value{
+			{Value: true, Type: plist.BooleanType},
+			{Value: []byte{1, 2, 3}, Type: plist.DataType},
+		}, Type: plist.ArrayType},
+	}, Type: plist.DictType}
+}
+
+func TestHashStable(t *testing.T) {
+	when := time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC)
+	expected := hashTestDict(when).Hash()
+	for i := 0; i < 20; i++ {
+		if hashTestDict(when).Hash() != expected {
+			t.Fatalf("hash differs between logically equal dicts")
+		}
+	}
+	zoned := when.In(time.FixedZone("CET", 3600))
+	if hashTestDict(zoned).Hash() != expected {
+		t.Errorf("hash depends on the date location")
+	}
+}
+
+func TestHashDistinguishesValues(t *testing.T) {
+	when := time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC)
+	a := hashTestDict(when)
+	b := hashTestDict(when.Add(time.Second))
+	if a.Hash() == b.Hash() {
+		t.Errorf("different dates produced the same hash")
+	}
+	s := plist.Value{Value: "1", Type: plist.StringType}
+	i := plist.Value{Value: int64(1), Type: plist.IntegerType}
+	if s.Hash() == i.Hash() {
+		t.Errorf("string and integer with the same text produced the same hash")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// integer returns an integer value as int64, or as uint64 with large set
+// when it exceeds math.MaxInt64.
+func (self Value) integer() (i int64, u uint64, large bool) {
+	if v, ok := self.Value.(uint64); ok {
+		if v > math.MaxInt64 {
+			return 0, v, true
+		}
+		return int64(v), 0, false
+	}
+	return self.Value.(int64), 0, false
+}
+
+// parseInteger parses the text of an integer in base 10, or in base 16 with
+// a "0x" prefix. Values above math.MaxInt64 are held as uint64, like
+// CFNumber does, all others as int64.
+func parseInteger(s string) (Value, error) {
+	text, base := s, 10
+	if len(s) > 2 && strings.ToLower(s[:2]) == "0x" {
+		text, base = s[2:], 16
+	}
+	i, err := strconv.ParseInt(text, base, 64)
+	if errors.Is(err, strconv.ErrRange) && i > 0 {
+		if u, err := strconv.ParseUint(text, base, 64); err == nil {
+			return Value{u, IntegerType}, nil
+		}
+	}
+	return valueWrap(IntegerType)(i, err)
+}
+
+// formatInteger returns the text of an integer value in base 10 or 16.
+func (self Value) formatInteger(base int) string {
+	if i, u, large := self.integer(); large {
+		return strconv.FormatUint(u, base)
+	} else {
+		return strconv.FormatInt(i, base)
+	}
+}
+
+// CoerceNumbers returns a copy of the value with all integers converted to
+// reals if toReal is set, otherwise all reals converted to integers by
+// truncating their fraction. Reals no integer can hold, NaN, infinities and
+// reals outside the range of int64 and uint64, stay reals. Dicts and arrays
+// are copied, other values are kept.
+func (self Value) CoerceNumbers(toReal bool) Value {
+	switch self.Type {
+	case ArrayType:
+		values := self.Value.([]Value)
+		result := make([]Value, len(values))
+		for i, v := range values {
+			result[i] = v.CoerceNumbers(toReal)
+		}
+		return Value{result, ArrayType}
+	case DictType:
+		m := self.dictMap()
+		result := make(map[string]Value, len(m))
+		for k, v := range m {
+			result[k] = v.CoerceNumbers(toReal)
+		}
+		if ordered, ok := self.Value.(*OrderedDict); ok {
+			return Value{&OrderedDict{Keys: append([]string(nil), ordered.Keys...), Map: result}, DictType}
+		}
+		return Value{result, DictType}
+	case IntegerType:
+		if toReal {
+			if i, u, large := self.integer(); large {
+				return Value{float64(u), RealType}
+			} else {
+				return Value{float64(i), RealType}
+			}
+		}
+	case RealType:
+		if f := math.Trunc(self.Value.(float64)); !toReal {
+			switch {
+			case f >= math.MinInt64 && f < math.MaxInt64:
+				return Value{int64(f), IntegerType}
+			case f >= 0 && f < math.MaxUint64:
+				return Value{uint64(f), IntegerType}
+			}
+		}
+	}
+	return self
+}
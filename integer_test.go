@@ -0,0 +1,89 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestCoerceNumbers(t *testing.T) {
+	value := mustRead(t, `<plist><dict>
+		<key>count</key><integer>3</integer>
+		<key>ratio</key><real>-2.75</real>
+		<key>huge</key><real>1e30</real>
+		<key>list</key><array><real>12.5</real><string>x</string><true/></array>
+	</dict></plist>`)
+	value.Dict().Set("large", plist.Value{Value: uint64(math.MaxUint64), Type: plist.IntegerType})
+	original := value.Clone()
+
+	reals := value.CoerceNumbers(true)
+	if !reals.EqualRaw(map[string]interface{}{
+		"count": 3.0,
+		"large": float64(math.MaxUint64),
+		"ratio": -2.75,
+		"huge":  1e30,
+		"list":  []interface{}{12.5, "x", true},
+	}) {
+		t.Errorf("unexpected reals %v", reals.Raw())
+	}
+
+	integers := value.CoerceNumbers(false)
+	if !integers.EqualRaw(map[string]interface{}{
+		"count": 3,
+		"large": uint64(math.MaxUint64),
+		"ratio": -2,
+		"huge":  1e30,
+		"list":  []interface{}{12, "x", true},
+	}) {
+		t.Errorf("unexpected integers %v", integers.Raw())
+	}
+	if !value.Equal(original) {
+		t.Errorf("CoerceNumbers modified the value")
+	}
+
+	nan := plist.Value{Value: math.NaN(), Type: plist.RealType}
+	if coerced := nan.CoerceNumbers(false); coerced.Type != plist.RealType {
+		t.Errorf("expected NaN to stay a real, got %v", coerced)
+	}
+	above := plist.Value{Value: float64(1 << 63), Type: plist.RealType}
+	if coerced := above.CoerceNumbers(false); !coerced.EqualRaw(uint64(1 << 63)) {
+		t.Errorf("unexpected result %v", coerced)
+	}
+}
+
+func TestReadLargeIntegers(t *testing.T) {
+	value := mustRead(t, `<plist><array>
+		<integer>9223372036854775807</integer>
+		<integer>9223372036854775808</integer>
+		<integer>18446744073709551615</integer>
+		<integer>0xFFFFFFFFFFFFFFFF</integer>
+		<integer>-9223372036854775808</integer>
+	</array></plist>`)
+	expected := []interface{}{int64(math.MaxInt64), uint64(1 << 63), uint64(math.MaxUint64), uint64(math.MaxUint64), int64(math.MinInt64)}
+	for i, v := range value.Value.([]plist.Value) {
+		if v.Value != expected[i] {
+			t.Errorf("unexpected value %T %v at %d", v.Value, v.Value, i)
+		}
+	}
+	if !value.EqualRaw(expected) {
+		t.Errorf("unexpected raw value %v", value.Raw())
+	}
+	out := encodeString(t, nil, value)
+	if !strings.Contains(out, "<integer>18446744073709551615</integer>") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if reread := mustRead(t, out); !reread.Equal(value) {
+		t.Errorf("unexpected round trip result %v", reread.Raw())
+	}
+
+	for _, text := range []string{"18446744073709551616", "-9223372036854775809", "0x10000000000000000"} {
+		if _, err := plist.Read(strings.NewReader("<plist><integer>" + text + "</integer></plist>")); err == nil {
+			t.Errorf("expected an error for %s", text)
+		}
+	}
+}
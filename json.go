@@ -0,0 +1,133 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// MarshalJSON implements json.Marshaler. Dicts become objects with sorted
+// keys, dates RFC 3339 strings, data base64 strings and UIDs numbers. Null
+// values are written as null. Reals which are NaN or infinite cannot be
+// represented and cause an error.
+func (self Value) MarshalJSON() ([]byte, error) {
+	raw, err := self.jsonValue(nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(raw)
+}
+
+func (self Value) jsonValue(path []string) (interface{}, error) {
+	switch self.Type {
+	case ArrayType:
+		values := self.Value.([]Value)
+		result := make([]interface{}, len(values))
+		for i, v := range values {
+			raw, err := v.jsonValue(append(path, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = raw
+		}
+		return result, nil
+	case DictType:
+		m := self.dictMap()
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			raw, err := v.jsonValue(append(path, k))
+			if err != nil {
+				return nil, err
+			}
+			result[k] = raw
+		}
+		return result, nil
+	case RealType:
+		if f := self.Value.(float64); math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, &NonFiniteError{Path: joinPath(path), Value: f}
+		}
+	case UIDType:
+		return uint64(self.Value.(UID)), nil
+	case DataType:
+		return self.data(), nil
+	case InvalidType:
+		return nil, fmt.Errorf("Invalid value at %q", joinPath(path))
+	}
+	return self.Value, nil
+}
+
+// FromRaw converts a native structure as returned by Raw or json.Unmarshal
+// into a Value. Go integers of any size become integers, float32 and float64
+// reals, nil null and json.Number an integer if it has no fraction or
+// exponent and a real otherwise. Values already of type Value are kept.
+func FromRaw(raw interface{}) (Value, error) {
+	return fromRaw(raw, nil)
+}
+
+func fromRaw(raw interface{}, path []string) (Value, error) {
+	if i, ok := rawInteger(raw); ok {
+		return Value{i, IntegerType}, nil
+	}
+	switch r := raw.(type) {
+	case nil:
+		return NullValue, nil
+	case Value:
+		return r, nil
+	case string:
+		return Value{r, StringType}, nil
+	case bool:
+		return Value{r, BooleanType}, nil
+	case uint:
+		return Value{uint64(r), IntegerType}, nil
+	case uint64:
+		return Value{r, IntegerType}, nil
+	case float32:
+		return Value{float64(r), RealType}, nil
+	case float64:
+		return Value{r, RealType}, nil
+	case json.Number:
+		if i, err := r.Int64(); err == nil {
+			return Value{i, IntegerType}, nil
+		}
+		if u, err := strconv.ParseUint(string(r), 10, 64); err == nil {
+			return Value{u, IntegerType}, nil
+		}
+		f, err := r.Float64()
+		if err != nil {
+			return InvalidValue, fmt.Errorf("Invalid number %q at %q", string(r), joinPath(path))
+		}
+		return Value{f, RealType}, nil
+	case []byte:
+		return Value{r, DataType}, nil
+	case time.Time:
+		return Value{r, DateType}, nil
+	case UID:
+		return Value{r, UIDType}, nil
+	case []interface{}:
+		values := make([]Value, len(r))
+		for i, e := range r {
+			value, err := fromRaw(e, append(path, strconv.Itoa(i)))
+			if err != nil {
+				return InvalidValue, err
+			}
+			values[i] = value
+		}
+		return Value{values, ArrayType}, nil
+	case map[string]interface{}:
+		m := make(map[string]Value, len(r))
+		for k, e := range r {
+			value, err := fromRaw(e, append(path, k))
+			if err != nil {
+				return InvalidValue, err
+			}
+			m[k] = value
+		}
+		return Value{m, DictType}, nil
+	}
+	return InvalidValue, fmt.Errorf("Unsupported type %T at %q", raw, joinPath(path))
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	value := plist.Value{Value: map[string]plist.Value{
+		"name":    {Value: "plist", Type: plist.StringType},
+		"count":   {Value: int64(3), Type: plist.IntegerType},
+		"ratio":   {Value: 0.5, Type: plist.RealType},
+		"missing": plist.NullValue,
+		"list":    {Value: []plist.Value{{Value: true, Type: plist.BooleanType}, plist.NullValue}, Type: plist.ArrayType},
+		"blob":    {Value: []byte("hi"), Type: plist.DataType},
+		"ref":     {Value: plist.UID(7), Type: plist.UIDType},
+	}, Type: plist.DictType}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+	expected := `{"blob":"aGk=","count":3,"list":[true,null],"missing":null,"name":"plist","ratio":0.5,"ref":7}`
+	if string(data) != expected {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	back, err := plist.FromRaw(raw)
+	if err != nil {
+		t.Fatalf("FromRaw failed: %s", err)
+	}
+	if m := back.Dict(); m["missing"].Type != plist.NullType || m["count"].Type != plist.IntegerType || m["ratio"].Type != plist.RealType {
+		t.Errorf("unexpected types after FromRaw: %v", back.Raw())
+	}
+
+	nan := plist.Value{Value: []plist.Value{{Value: math.NaN(), Type: plist.RealType}}, Type: plist.ArrayType}
+	var nonFinite *plist.NonFiniteError
+	if _, err := json.Marshal(nan); !errors.As(err, &nonFinite) || nonFinite.Path != "0" {
+		t.Errorf("expected a NonFiniteError at 0, got %v", err)
+	}
+}
+
+func TestFromRaw(t *testing.T) {
+	raw := map[string]interface{}{
+		"small": uint8(1),
+		"large": uint64(math.MaxUint64),
+		"float": float32(1.5),
+		"null":  nil,
+		"list":  []interface{}{"a", int64(2)},
+	}
+	value, err := plist.FromRaw(raw)
+	if err != nil {
+		t.Fatalf("FromRaw failed: %s", err)
+	}
+	if !value.EqualRaw(raw) {
+		t.Errorf("FromRaw result differs: %v", value.Raw())
+	}
+	if kept, err := plist.FromRaw(plist.NullValue); err != nil || kept != plist.NullValue {
+		t.Errorf("expected a Value to be kept, got %v, %v", kept, err)
+	}
+	if _, err := plist.FromRaw(map[string]interface{}{"a": []interface{}{struct{}{}}}); err == nil || !strings.Contains(err.Error(), `"a.0"`) {
+		t.Errorf("expected an error naming a.0, got %v", err)
+	}
+}
+
+func TestWriteNull(t *testing.T) {
+	value := plist.Value{Value: []plist.Value{plist.NullValue}, Type: plist.ArrayType}
+	if out := encodeString(t, nil, value); !strings.Contains(out, "<array>\n    <string/>\n  </array>") {
+		t.Errorf("unexpected output for null:\n%s", out)
+	}
+	if !plist.NullValue.IsScalar() || !plist.NullValue.Equal(plist.NullValue) {
+		t.Errorf("unexpected null predicates")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"reflect"
+	"sync"
+)
+
+// minCachedKeys is the size from which the keys of a dict are cached, smaller
+// dicts are sorted faster than they are looked up.
+const minCachedKeys = 16
+
+// KeyCache remembers the sorted keys of dicts between writes, see
+// WriteOptions.KeyCache. Before cached keys are used they are checked against
+// the dict, so modifying a dict in any way only costs a new sort. The keys
+// of dicts which are no longer written are kept until Reset is called.
+//
+// The zero value is ready to use. A KeyCache is safe for concurrent use but
+// must only be shared by writers with the same KeyLess function.
+type KeyCache struct {
+	mutex   sync.RWMutex
+	entries map[uintptr]keyCacheEntry
+}
+
+type keyCacheEntry struct {
+	sort KeySort
+	keys []string
+}
+
+// Reset discards all cached keys.
+func (self *KeyCache) Reset() {
+	self.mutex.Lock()
+	self.entries = nil
+	self.mutex.Unlock()
+}
+
+// lookup returns the cached keys of m if they were sorted with keySort and
+// are still exactly the keys of m.
+func (self *KeyCache) lookup(m map[string]Value, keySort KeySort) ([]string, bool) {
+	self.mutex.RLock()
+	entry, ok := self.entries[reflect.ValueOf(m).Pointer()]
+	self.mutex.RUnlock()
+	if !ok || entry.sort != keySort || len(entry.keys) != len(m) {
+		return nil, false
+	}
+	for _, key := range entry.keys {
+		if _, ok := m[key]; !ok {
+			return nil, false
+		}
+	}
+	return entry.keys, true
+}
+
+func (self *KeyCache) store(m map[string]Value, keySort KeySort, keys []string) {
+	self.mutex.Lock()
+	if self.entries == nil {
+		self.entries = map[uintptr]keyCacheEntry{}
+	}
+	self.entries[reflect.ValueOf(m).Pointer()] = keyCacheEntry{keySort, keys}
+	self.mutex.Unlock()
+}
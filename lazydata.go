@@ -0,0 +1,97 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"sync"
+)
+
+// lazyData holds the base64 text of a data value read with
+// DecodeOptions.LazyData until its bytes are needed. The text is known to
+// decode with encoding.
+type lazyData struct {
+	text     string
+	encoding *base64.Encoding
+	once     sync.Once
+	data     []byte
+}
+
+func (self *lazyData) bytes() []byte {
+	self.once.Do(func() {
+		self.data, _ = self.encoding.DecodeString(self.text)
+	})
+	return self.data
+}
+
+// data returns the bytes of a data value.
+func (self Value) data() []byte {
+	if lazy, ok := self.Value.(*lazyData); ok {
+		return lazy.bytes()
+	}
+	return self.Value.([]byte)
+}
+
+// Data returns the bytes of a data value, decoding them first if the value
+// was read with DecodeOptions.LazyData. The result is false for other
+// values.
+func (self Value) Data() ([]byte, bool) {
+	if self.Type != DataType {
+		return nil, false
+	}
+	return self.data(), true
+}
+
+// base64Chunk is the length of the text checkBase64 decodes at once, a
+// multiple of the four characters of a base64 quantum.
+const base64Chunk = 4096
+
+// checkBase64 reports whether encoding decodes s, decoding it in chunks into
+// the buffer of the decoder instead of allocating the data. Padding ends the
+// text, so only the last chunk may hold it.
+func (self *Decoder) checkBase64(encoding *base64.Encoding, s string) bool {
+	if self.scratch == nil {
+		self.scratch = make([]byte, base64Chunk+base64.StdEncoding.DecodedLen(base64Chunk))
+	}
+	text, data := self.scratch[:base64Chunk], self.scratch[base64Chunk:]
+	for len(s) > 0 {
+		n := copy(text, s)
+		if n < len(s) && bytes.IndexByte(text[:n], '=') >= 0 {
+			return false
+		}
+		if _, err := encoding.Decode(data, text[:n]); err != nil {
+			return false
+		}
+		s = s[n:]
+	}
+	return true
+}
+
+// lazyData returns a data value holding the base64 text s, trying the
+// encodings in the order decodeBase64 and decodeLenientBase64 do.
+func (self *Decoder) lazyData(encoding *base64.Encoding, s string) (Value, error) {
+	encodings, texts := []*base64.Encoding{encoding}, []string{s}
+	if self.LenientData {
+		encodings = append(encodings, base64.URLEncoding)
+		if stripped := stripBase64(s); stripped != s {
+			texts = append(texts, stripped)
+		}
+	}
+	for _, text := range texts {
+		for _, encoding := range encodings {
+			if self.checkBase64(encoding, text) {
+				return Value{&lazyData{text: text, encoding: encoding}, DataType}, nil
+			}
+			raw, trimmed := encoding.WithPadding(base64.NoPadding), strings.TrimRight(text, "=")
+			if self.checkBase64(raw, trimmed) {
+				return Value{&lazyData{text: trimmed, encoding: raw}, DataType}, nil
+			}
+		}
+	}
+	// Report the error of the first encoding.
+	_, err := decodeBase64(encoding, s)
+	return InvalidValue, err
+}
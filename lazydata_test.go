@@ -0,0 +1,156 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+const lazyDocument = `<plist version="1.0"><dict>
+	<key>blob</key><data>
+		aGVsbG8g
+		d29ybGQ=
+	</data>
+	<key>empty</key><data/>
+	<key>unpadded</key><data>aGk</data>
+	<key>list</key><array><data>AAEC</data><string>x</string></array>
+</dict></plist>`
+
+func decodeLazy(t *testing.T, document string, lazy bool) plist.Value {
+	decoder := plist.NewDecoder(strings.NewReader(document))
+	decoder.LazyData = lazy
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	return value
+}
+
+func TestLazyDataAccessors(t *testing.T) {
+	eager, lazy := decodeLazy(t, lazyDocument, false), decodeLazy(t, lazyDocument, true)
+	if _, ok := lazy.Dict()["blob"].Value.([]byte); ok {
+		t.Errorf("expected the data to stay undecoded")
+	}
+	if !lazy.Equal(eager) || !eager.Equal(lazy) {
+		t.Errorf("lazy value differs from %v", eager.Raw())
+	}
+	if !reflect.DeepEqual(lazy.Raw(), eager.Raw()) {
+		t.Errorf("unexpected Raw result %v", lazy.Raw())
+	}
+	if data, ok := lazy.Dict()["blob"].Data(); !ok || string(data) != "hello world" {
+		t.Errorf("unexpected Data result %q", data)
+	}
+	if data, err := lazy.DataAt("list.0"); err != nil || !bytes.Equal(data, []byte{0, 1, 2}) {
+		t.Errorf("unexpected DataAt result %v, %v", data, err)
+	}
+	if lazy.Hash() != eager.Hash() {
+		t.Errorf("hashes differ")
+	}
+	if !lazy.Clone().Equal(eager) {
+		t.Errorf("unexpected clone")
+	}
+	if !reflect.DeepEqual(lazy.Flatten("."), eager.Flatten(".")) || !reflect.DeepEqual(lazy.CollectData(), eager.CollectData()) {
+		t.Errorf("unexpected Flatten or CollectData result")
+	}
+	lazyJSON, _ := json.Marshal(lazy)
+	eagerJSON, _ := json.Marshal(eager)
+	if !bytes.Equal(lazyJSON, eagerJSON) {
+		t.Errorf("unexpected JSON %s", lazyJSON)
+	}
+	var lazyDump, eagerDump bytes.Buffer
+	lazy.Dump(&lazyDump)
+	eager.Dump(&eagerDump)
+	if lazyDump.String() != eagerDump.String() {
+		t.Errorf("unexpected dump\n%s", lazyDump.String())
+	}
+	var target struct {
+		Blob     []byte `plist:"blob"`
+		Unpadded []byte `plist:"unpadded"`
+	}
+	if err := lazy.Unmarshal(&target); err != nil || string(target.Blob) != "hello world" || string(target.Unpadded) != "hi" {
+		t.Errorf("unexpected Unmarshal result %q, %v", target, err)
+	}
+	lazyOut, err := lazy.XMLString()
+	eagerOut, _ := eager.XMLString()
+	if err != nil || lazyOut != eagerOut {
+		t.Errorf("unexpected output %v\n%s", err, lazyOut)
+	}
+}
+
+func TestLazyDataPassThrough(t *testing.T) {
+	// The last character has bits set which encoding discards, so only the
+	// original text reproduces it.
+	const document = `<plist><data>aGl=</data></plist>`
+	for _, test := range []struct {
+		lazy     bool
+		encoding *base64.Encoding
+		text     string
+	}{
+		{true, nil, "<data>aGl=</data>"},
+		{false, nil, "<data>aGk=</data>"},
+		{true, base64.URLEncoding, "<data>aGk=</data>"},
+	} {
+		value := decodeLazy(t, document, test.lazy)
+		out := encodeString(t, func(e *plist.Encoder) { e.DataEncoding = test.encoding }, value)
+		if !strings.Contains(out, test.text) {
+			t.Errorf("lazy %v, encoding %v: expected %s:\n%s", test.lazy, test.encoding, test.text, out)
+		}
+	}
+
+	// Wrapping applies to copied text too.
+	value := decodeLazy(t, lazyDocument, true)
+	out := encodeString(t, func(e *plist.Encoder) { e.DataWrapWidth = 4 }, value)
+	if !strings.Contains(out, "\n    aGVs\n    bG8g\n") {
+		t.Errorf("expected wrapped data:\n%s", out)
+	}
+}
+
+func TestLazyDataErrors(t *testing.T) {
+	for _, document := range []string{
+		`<plist><data>aGVs*G8=</data></plist>`,
+		`<plist><data>` + strings.Repeat("AAAA", 2000) + `A</data></plist>`,
+		// Padding in a chunk that does not end the data.
+		`<plist><data>` + strings.Repeat("A", 4092) + `AA==AAAA</data></plist>`,
+	} {
+		decoder := plist.NewDecoder(strings.NewReader(document))
+		decoder.LazyData = true
+		_, lazyErr := decoder.Decode()
+		_, eagerErr := plist.ParseString(document)
+		if lazyErr == nil || eagerErr == nil || lazyErr.Error() != eagerErr.Error() {
+			t.Errorf("expected the error %v, got %v", eagerErr, lazyErr)
+		}
+	}
+
+	for _, text := range []string{"-_-_", "-_.-_"} {
+		decoder := plist.NewDecoder(strings.NewReader(`<plist><data>` + text + `</data></plist>`))
+		decoder.LazyData = true
+		decoder.LenientData = true
+		if value, err := decoder.Decode(); err != nil || !value.EqualRaw([]byte{0xfb, 0xff, 0xbf}) {
+			t.Errorf("unexpected result %v, %v for %q", value, err, text)
+		}
+	}
+}
+
+func TestLazyDataConcurrentAccess(t *testing.T) {
+	value := decodeLazy(t, lazyDocument, true).Dict()["blob"]
+	var group sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if data, _ := value.Data(); string(data) != "hello world" {
+				t.Errorf("unexpected data %q", data)
+			}
+		}()
+	}
+	group.Wait()
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+// ArrayStrategy selects how Merge combines two arrays.
+type ArrayStrategy int
+
+const (
+	// ReplaceArrays uses the array of the overlay.
+	ReplaceArrays ArrayStrategy = iota
+	// AppendArrays appends the elements of the overlay to the base.
+	AppendArrays
+	// UnionArrays appends the elements of the overlay which are not Equal to
+	// an element already present.
+	UnionArrays
+)
+
+// MergeOptions control how Merge combines values.
+type MergeOptions struct {
+	// ArrayStrategy selects how arrays present in both values are combined,
+	// ReplaceArrays by default.
+	ArrayStrategy ArrayStrategy
+}
+
+// Merge returns base with overlay layered on top. Dicts are merged key by
+// key, recursively. Arrays are combined according to options.ArrayStrategy.
+// In all other cases, including differing types, the overlay wins. Neither
+// base nor overlay is modified, the result shares no containers with them.
+// Merging into an *OrderedDict keeps its key order and appends new keys.
+func Merge(base, overlay Value, options MergeOptions) Value {
+	switch {
+	case base.Type == DictType && overlay.Type == DictType:
+		result := base.Clone()
+		m := overlay.dictMap()
+		for _, key := range overlay.dictKeys() {
+			value := m[key].Clone()
+			if existing, ok := result.dictMap()[key]; ok {
+				value = Merge(existing, m[key], options)
+			}
+			if ordered, ok := result.Value.(*OrderedDict); ok {
+				ordered.Set(key, value)
+			} else {
+				result.Value.(map[string]Value)[key] = value
+			}
+		}
+		return result
+	case base.Type == ArrayType && overlay.Type == ArrayType && options.ArrayStrategy != ReplaceArrays:
+		result := base.Clone()
+		values := result.Value.([]Value)
+		for _, value := range overlay.Value.([]Value) {
+			if options.ArrayStrategy == UnionArrays && containsValue(values, value) {
+				continue
+			}
+			values = append(values, value.Clone())
+		}
+		return Value{values, ArrayType}
+	}
+	return overlay.Clone()
+}
+
+func containsValue(values []Value, value Value) bool {
+	for _, v := range values {
+		if v.Equal(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns a deep copy of the value. Dicts, arrays and data are copied,
+// *OrderedDict values stay ordered.
+func (self Value) Clone() Value {
+	switch self.Type {
+	case ArrayType:
+		values := self.Value.([]Value)
+		result := make([]Value, len(values))
+		for i, v := range values {
+			result[i] = v.Clone()
+		}
+		return Value{result, ArrayType}
+	case DictType:
+		m := self.dictMap()
+		result := make(map[string]Value, len(m))
+		for k, v := range m {
+			result[k] = v.Clone()
+		}
+		if ordered, ok := self.Value.(*OrderedDict); ok {
+			return Value{&OrderedDict{Keys: append([]string(nil), ordered.Keys...), Map: result}, DictType}
+		}
+		return Value{result, DictType}
+	case DataType:
+		return Value{append([]byte{}, self.data()...), DataType}
+	}
+	return self
+}
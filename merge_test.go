@@ -0,0 +1,75 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+const mergeBase = `<plist><dict>
+	<key>name</key><string>base</string>
+	<key>paths</key><array><string>/usr/bin</string><string>/bin</string></array>
+	<key>env</key><dict><key>HOME</key><string>/root</string><key>LANG</key><string>C</string></dict>
+</dict></plist>`
+
+const mergeOverlay = `<plist><dict>
+	<key>name</key><string>overlay</string>
+	<key>paths</key><array><string>/bin</string><string>/opt/bin</string></array>
+	<key>env</key><dict><key>LANG</key><string>en_US</string></dict>
+	<key>debug</key><true/>
+</dict></plist>`
+
+func TestMergeArrayStrategies(t *testing.T) {
+	base, overlay := mustRead(t, mergeBase), mustRead(t, mergeOverlay)
+	for strategy, paths := range map[plist.ArrayStrategy][]interface{}{
+		plist.ReplaceArrays: {"/bin", "/opt/bin"},
+		plist.AppendArrays:  {"/usr/bin", "/bin", "/bin", "/opt/bin"},
+		plist.UnionArrays:   {"/usr/bin", "/bin", "/opt/bin"},
+	} {
+		merged := plist.Merge(base, overlay, plist.MergeOptions{ArrayStrategy: strategy})
+		expected := map[string]interface{}{
+			"name":  "overlay",
+			"paths": paths,
+			"env":   map[string]interface{}{"HOME": "/root", "LANG": "en_US"},
+			"debug": true,
+		}
+		if !merged.EqualRaw(expected) {
+			t.Errorf("unexpected result for strategy %d: %v", strategy, merged.Raw())
+		}
+	}
+	if !base.Equal(mustRead(t, mergeBase)) || !overlay.Equal(mustRead(t, mergeOverlay)) {
+		t.Errorf("Merge modified its arguments")
+	}
+}
+
+func TestMergeOrderedDict(t *testing.T) {
+	base := decodeOrdered(t, mergeBase)
+	merged := plist.Merge(base, mustRead(t, mergeOverlay), plist.MergeOptions{})
+	ordered, ok := merged.Value.(*plist.OrderedDict)
+	if !ok {
+		t.Fatalf("expected an *OrderedDict, got %T", merged.Value)
+	}
+	expected := []string{"name", "paths", "env", "debug"}
+	if len(ordered.Keys) != len(expected) {
+		t.Fatalf("unexpected keys %v", ordered.Keys)
+	}
+	for i, key := range expected {
+		if ordered.Keys[i] != key {
+			t.Errorf("unexpected keys %v", ordered.Keys)
+			break
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	value := mustRead(t, `<plist><dict><key>a</key><array><data>AAEC</data></array></dict></plist>`)
+	clone := value.Clone()
+	data := clone.Value.(map[string]plist.Value)["a"].Value.([]plist.Value)[0].Value.([]byte)
+	data[0] = 9
+	if !value.Equal(mustRead(t, `<plist><dict><key>a</key><array><data>AAEC</data></array></dict></plist>`)) {
+		t.Errorf("modifying the clone changed the original")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"encoding/xml"
+	"math"
+)
+
+// Metadata holds details of a decoded document which are not part of its
+// Value tree. It is recorded when requested by DecodeOptions, see
+// Decoder.Metadata, and reproduced by passing it in WriteOptions.Metadata.
+type Metadata struct {
+	// numbers maps key paths to the original text of integers and reals.
+	numbers map[string]numberText
+	// attributes maps key paths to the attributes of value elements.
+	attributes map[string][]xml.Attr
+	// plist holds the attributes of the plist element.
+	plist []xml.Attr
+	// encoding is the encoding named by the XML declaration.
+	encoding string
+	// comments maps key paths to the comments before the value, trailing
+	// to those after the last entry or element of a dict or array.
+	comments map[string]string
+	trailing map[string]string
+}
+
+type numberText struct {
+	text  string
+	value Value
+}
+
+// numberText returns the recorded text of the integer or real value at path,
+// provided value still equals the decoded value.
+func (self *Metadata) numberText(path string, value Value) (string, bool) {
+	if self == nil {
+		return "", false
+	}
+	number, ok := self.numbers[path]
+	if !ok || number.value.Type != value.Type {
+		return "", false
+	}
+	if value.Type == RealType {
+		// Compare bits to tell negative from positive zero.
+		if math.Float64bits(number.value.Value.(float64)) != math.Float64bits(value.Value.(float64)) {
+			return "", false
+		}
+	} else if number.value.Value != value.Value {
+		return "", false
+	}
+	return number.text, true
+}
+
+// Attributes returns the attributes recorded for the value element at the
+// key path, with prefixed names in Name.Local.
+func (self *Metadata) Attributes(path string) []xml.Attr {
+	if self == nil {
+		return nil
+	}
+	return self.attributes[path]
+}
+
+// PlistAttributes returns the attributes recorded for the plist element.
+func (self *Metadata) PlistAttributes() []xml.Attr {
+	if self == nil {
+		return nil
+	}
+	return self.plist
+}
+
+// Encoding returns the encoding named by the XML declaration, or "" if none
+// was recorded.
+func (self *Metadata) Encoding() string {
+	if self == nil {
+		return ""
+	}
+	return self.encoding
+}
+
+// Comment returns the comments recorded before the root value, dict entry or
+// array element at the key path.
+func (self *Metadata) Comment(path string) (string, bool) {
+	if self == nil {
+		return "", false
+	}
+	text, ok := self.comments[path]
+	return text, ok
+}
+
+// TrailingComment returns the comments recorded after the last entry or
+// element of the dict or array at the key path.
+func (self *Metadata) TrailingComment(path string) (string, bool) {
+	if self == nil {
+		return "", false
+	}
+	text, ok := self.trailing[path]
+	return text, ok
+}
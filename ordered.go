@@ -0,0 +1,127 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// OrderedDict is the representation of DictType values decoded with
+// DecodeOptions.OrderedDicts. Next to the entries it remembers the order in
+// which the keys appeared in the document.
+type OrderedDict struct {
+	// Keys lists the keys of Map in their original order.
+	Keys []string
+	// Map holds the entries of the dict.
+	Map map[string]Value
+}
+
+// NewOrderedDict returns an empty OrderedDict.
+func NewOrderedDict() *OrderedDict {
+	return &OrderedDict{Map: map[string]Value{}}
+}
+
+// Set stores value under key. New keys are appended to Keys.
+func (self *OrderedDict) Set(key string, value Value) {
+	if _, ok := self.Map[key]; !ok {
+		self.Keys = append(self.Keys, key)
+	}
+	self.Map[key] = value
+}
+
+// Delete removes key from the dict.
+func (self *OrderedDict) Delete(key string) {
+	if _, ok := self.Map[key]; !ok {
+		return
+	}
+	delete(self.Map, key)
+	for i, k := range self.Keys {
+		if k == key {
+			self.Keys = append(self.Keys[:i], self.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// orderedKeys returns the keys of Map in the order of Keys. Keys missing from
+// Keys, e.g. added by modifying Map directly, follow in lexical order.
+func (self *OrderedDict) orderedKeys() []string {
+	keys := make([]string, 0, len(self.Map))
+	seen := make(map[string]bool, len(self.Map))
+	for _, key := range self.Keys {
+		if _, ok := self.Map[key]; ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == len(self.Map) {
+		return keys
+	}
+	rest := make([]string, 0, len(self.Map)-len(keys))
+	for key := range self.Map {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// KeyValue is a single entry of a dict.
+type KeyValue struct {
+	Key   string
+	Value Value
+}
+
+// ReadOrdered reads a plist document holding a dict and returns its entries
+// in document order. Nested dicts are decoded as *OrderedDict.
+func ReadOrdered(reader io.Reader) ([]KeyValue, error) {
+	decoder := NewDecoder(reader)
+	decoder.OrderedDicts = true
+	value, err := decoder.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return value.OrderedEntries()
+}
+
+// OrderedEntries returns the entries of a dict. Dicts held as *OrderedDict,
+// see DecodeOptions.OrderedDicts, return them in their original order. The
+// order of other dicts was lost when they were read, their entries are
+// returned sorted by key.
+func (self Value) OrderedEntries() ([]KeyValue, error) {
+	if self.Type != DictType {
+		return nil, fmt.Errorf("Expected a dict, found %s", self.Type.Name())
+	}
+	m := self.dictMap()
+	entries := make([]KeyValue, 0, len(m))
+	for _, key := range self.dictKeys() {
+		entries = append(entries, KeyValue{key, m[key]})
+	}
+	return entries, nil
+}
+
+// dictMap returns the entries of a DictType value for either representation.
+func (self Value) dictMap() map[string]Value {
+	if ordered, ok := self.Value.(*OrderedDict); ok {
+		return ordered.Map
+	}
+	return self.Value.(map[string]Value)
+}
+
+// dictKeys returns the keys of a DictType value, in their original order for
+// an *OrderedDict and sorted otherwise.
+func (self Value) dictKeys() []string {
+	if ordered, ok := self.Value.(*OrderedDict); ok {
+		return ordered.orderedKeys()
+	}
+	keys := make([]string, 0, len(self.dictMap()))
+	for key := range self.dictMap() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+const orderedDocument = `<plist version="1.0">
+<dict>
+	<key>zeta</key><integer>1</integer>
+	<key>alpha</key><dict>
+		<key>second</key><true/>
+		<key>first</key><false/>
+	</dict>
+	<key>middle</key><string>m</string>
+</dict>
+</plist>`
+
+func decodeOrdered(t *testing.T, data string) plist.Value {
+	t.Helper()
+	decoder := plist.NewDecoder(strings.NewReader(data))
+	decoder.OrderedDicts = true
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	return value
+}
+
+func TestOrderedDictsRoundTrip(t *testing.T) {
+	value := decodeOrdered(t, orderedDocument)
+	ordered, ok := value.Value.(*plist.OrderedDict)
+	if !ok {
+		t.Fatalf("expected *OrderedDict, got %T", value.Value)
+	}
+	if !reflect.DeepEqual(ordered.Keys, []string{"zeta", "alpha", "middle"}) {
+		t.Errorf("unexpected key order %v", ordered.Keys)
+	}
+
+	out := encodeString(t, func(e *plist.Encoder) { e.KeySort = plist.PreserveSort }, value)
+	if keys := strings.Join(keyOrder(out), " "); keys != "zeta alpha second first middle" {
+		t.Errorf("unexpected key order %s", keys)
+	}
+	out = encodeString(t, nil, value)
+	if keys := strings.Join(keyOrder(out), " "); keys != "alpha first second middle zeta" {
+		t.Errorf("unexpected default key order %s", keys)
+	}
+}
+
+func TestOrderedDictsRaw(t *testing.T) {
+	ordered := decodeOrdered(t, orderedDocument).Raw()
+	plain := mustRead(t, orderedDocument).Raw()
+	if !reflect.DeepEqual(ordered, plain) {
+		t.Errorf("Raw differs between ordered and plain dicts:\n%v\n%v", ordered, plain)
+	}
+	if decodeOrdered(t, orderedDocument).Hash() != mustRead(t, orderedDocument).Hash() {
+		t.Errorf("Hash differs between ordered and plain dicts")
+	}
+	if _, ok := mustRead(t, orderedDocument).Value.(map[string]plist.Value); !ok {
+		t.Errorf("dicts decoded without OrderedDicts must stay map[string]Value")
+	}
+}
+
+func TestOrderedDictModification(t *testing.T) {
+	value := decodeOrdered(t, orderedDocument)
+	ordered := value.Value.(*plist.OrderedDict)
+	ordered.Delete("alpha")
+	ordered.Set("beta", plist.Value{Value: "b", Type: plist.StringType})
+	ordered.Map["aaa"] = plist.Value{Value: "a", Type: plist.StringType}
+	out := encodeString(t, func(e *plist.Encoder) { e.KeySort = plist.PreserveSort }, value)
+	if keys := strings.Join(keyOrder(out), " "); keys != "zeta middle beta aaa" {
+		t.Errorf("unexpected key order %s", keys)
+	}
+}
+
+func TestReadOrdered(t *testing.T) {
+	entries, err := plist.ReadOrdered(strings.NewReader(orderedDocument))
+	if err != nil {
+		t.Fatalf("ReadOrdered failed: %s", err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"zeta", "alpha", "middle"}) {
+		t.Errorf("unexpected key order %v", keys)
+	}
+	if nested, ok := entries[1].Value.Value.(*plist.OrderedDict); !ok || !reflect.DeepEqual(nested.Keys, []string{"second", "first"}) {
+		t.Errorf("unexpected nested dict %#v", entries[1].Value.Value)
+	}
+	if _, err := plist.ReadOrdered(strings.NewReader(`<plist><array/></plist>`)); err == nil {
+		t.Errorf("expected an error for an array")
+	}
+}
+
+func TestOrderedEntries(t *testing.T) {
+	keys := func(entries []plist.KeyValue) string {
+		var keys []string
+		for _, entry := range entries {
+			keys = append(keys, entry.Key)
+		}
+		return strings.Join(keys, " ")
+	}
+	entries, err := decodeOrdered(t, orderedDocument).OrderedEntries()
+	if err != nil || keys(entries) != "zeta alpha middle" {
+		t.Errorf("unexpected entries %v, %v", keys(entries), err)
+	}
+	entries, err = mustRead(t, orderedDocument).OrderedEntries()
+	if err != nil || keys(entries) != "alpha middle zeta" {
+		t.Errorf("unexpected entries %v, %v for a map", keys(entries), err)
+	}
+	if entries[0].Value.Type != plist.DictType {
+		t.Errorf("unexpected value %v", entries[0].Value)
+	}
+	if _, err := plist.NullValue.OrderedEntries(); err == nil {
+		t.Errorf("expected an error for a null value")
+	}
+}
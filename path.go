@@ -0,0 +1,62 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Key paths address values inside a tree. A path consists of the dict keys
+// and array indices leading to the value joined with dots, for example
+// "Payloads.0.PayloadType". The root value has the empty path. Keys which
+// contain dots cannot be addressed.
+const pathSeparator = "."
+
+func joinPath(segments []string) string {
+	return strings.Join(segments, pathSeparator)
+}
+
+// Query returns the value at the key path below the value. An error names the
+// first segment of path which cannot be resolved.
+func (self Value) Query(path string) (Value, error) {
+	if path == "" {
+		return self, nil
+	}
+	value := self
+	segments := strings.Split(path, pathSeparator)
+	for i, segment := range segments {
+		switch value.Type {
+		case DictType:
+			next, ok := value.dictMap()[segment]
+			if !ok {
+				return InvalidValue, fmt.Errorf("No key %q at %q", segment, joinPath(segments[:i]))
+			}
+			value = next
+		case ArrayType:
+			values := value.Value.([]Value)
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(values) {
+				return InvalidValue, fmt.Errorf("No index %q in array of %d at %q", segment, len(values), joinPath(segments[:i]))
+			}
+			value = values[index]
+		default:
+			return InvalidValue, fmt.Errorf("Cannot look up %q in %s at %q", segment, value.Type.Name(), joinPath(segments[:i]))
+		}
+	}
+	return value, nil
+}
+
+// DataAt returns the payload of the data value at the key path.
+func (self Value) DataAt(path string) ([]byte, error) {
+	value, err := self.Query(path)
+	if err != nil {
+		return nil, err
+	}
+	if value.Type != DataType {
+		return nil, fmt.Errorf("Expected data at %q, found %s", path, value.Type.Name())
+	}
+	return value.data(), nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"testing"
+)
+
+const queryDocument = `<plist><dict>
+	<key>Signature</key><data>AAEC</data>
+	<key>Payloads</key><array><dict><key>PayloadType</key><string>wifi</string></dict></array>
+</dict></plist>`
+
+func TestQuery(t *testing.T) {
+	value := mustRead(t, queryDocument)
+	if result, err := value.Query("Payloads.0.PayloadType"); err != nil || result.Value != "wifi" {
+		t.Errorf("unexpected result %v, %v", result.Value, err)
+	}
+	if result, err := value.Query(""); err != nil || !result.Equal(value) {
+		t.Errorf("expected the root for the empty path, got %v", err)
+	}
+	for _, path := range []string{"Missing", "Payloads.1", "Payloads.x", "Payloads.-1", "Signature.0", "Payloads.0.PayloadType.x"} {
+		if _, err := value.Query(path); err == nil {
+			t.Errorf("expected an error for %s", path)
+		}
+	}
+}
+
+func TestDataAt(t *testing.T) {
+	value := mustRead(t, queryDocument)
+	if data, err := value.DataAt("Signature"); err != nil || !bytes.Equal(data, []byte{0, 1, 2}) {
+		t.Errorf("unexpected data %v, %v", data, err)
+	}
+	if _, err := value.DataAt("Payloads.0.PayloadType"); err == nil {
+		t.Errorf("expected an error for a string")
+	}
+	if _, err := value.DataAt("Missing"); err == nil {
+		t.Errorf("expected an error for a missing key")
+	}
+}
@@ -4,24 +4,43 @@
 package plist
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
-	"sort"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// whitespaceReplacer removes the ASCII whitespace of wrapped and indented
+// data text.
 var whitespaceReplacer *strings.Replacer
 
 func init() {
-	whitespaceReplacer = strings.NewReplacer("\t", "", " ", "")
+	whitespaceReplacer = strings.NewReplacer("\t", "", " ", "", "\n", "", "\r", "", "\f", "", "\v", "")
 }
 
 var InvalidTypeError = fmt.Errorf("Invalid Value Type")
 
+// ErrTruncated is wrapped by errors reporting input which ends within a
+// document, test for it with errors.Is.
+var ErrTruncated = errors.New("Truncated plist")
+
+// ErrUnsupportedFormat is wrapped by errors reporting input in a plist
+// format other than XML, like the bplist00, bplist15 and bplist16 binary
+// formats, test for it with errors.Is.
+var ErrUnsupportedFormat = errors.New("Unsupported plist format")
+
+const utf8BOM = "\xEF\xBB\xBF"
+
+// binaryMagic starts binary plists, followed by two version characters.
+const binaryMagic = "bplist"
+
 type invalidPListError struct {
 	inputOffset   int64
 	internalError error
@@ -31,6 +50,18 @@ func (self invalidPListError) Error() string {
 	return fmt.Sprintf("PList error line: %d: %s", self.inputOffset, self.internalError.Error())
 }
 
+func (self invalidPListError) Unwrap() error {
+	return self.internalError
+}
+
+// isTruncation reports whether err signals the end of the input.
+func isTruncation(err error) bool {
+	if syntaxError, ok := err.(*xml.SyntaxError); ok {
+		return syntaxError.Msg == "unexpected EOF"
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
 func plistErrorFromString(offset int64, msg string) *invalidPListError {
 	return &invalidPListError{
 		offset,
@@ -39,12 +70,23 @@ func plistErrorFromString(offset int64, msg string) *invalidPListError {
 }
 
 func plistErrorFromError(offset int64, err error) *invalidPListError {
+	if isTruncation(err) {
+		err = fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
 	return &invalidPListError{
 		offset,
 		err,
 	}
 }
 
+// withOffset wraps err with offset unless it carries an offset already.
+func withOffset(offset int64, err error) error {
+	if _, ok := err.(*invalidPListError); ok {
+		return err
+	}
+	return plistErrorFromError(offset, err)
+}
+
 type ValueType int
 
 const (
@@ -54,7 +96,8 @@ const (
 	StringType
 	// DateType refers to time.Time.
 	DateType
-	// IntegerType refers to int64.
+	// IntegerType refers to int64, or to uint64 for values above
+	// math.MaxInt64.
 	IntegerType
 	// RealType refers to float64.
 	RealType
@@ -62,10 +105,19 @@ const (
 	BooleanType
 	// DataType refers to []byte.
 	DataType
-	// DictType refers to map[string]Value.
+	// DictType refers to map[string]Value, or *OrderedDict when decoded
+	// with DecodeOptions.OrderedDicts.
 	DictType
-	// ArrayType refers to []Value
+	// ArrayType refers to []Value. Sets of binary plists, which the XML
+	// format cannot express, are to be held as arrays of their elements in
+	// stored order, the way NSKeyedArchiver writes NSSet members to XML.
 	ArrayType
+	// UIDType refers to UID.
+	UIDType
+	// NullType refers to nil. Plists cannot express null, it only exists
+	// in memory to bridge formats like JSON and is written as an empty
+	// string.
+	NullType
 
 	typeCount
 )
@@ -80,6 +132,8 @@ var valueTypeNames = [typeCount]string{
 	DataType:    "data",
 	DictType:    "dict",
 	ArrayType:   "array",
+	UIDType:     "uid",
+	NullType:    "null",
 }
 
 // Name returns a human readable string as name of the ValueType
@@ -93,92 +147,123 @@ type Value struct {
 	Type  ValueType
 }
 
+// IsDict reports whether the value is a dict.
+func (self Value) IsDict() bool {
+	return self.Type == DictType
+}
+
+// IsArray reports whether the value is an array.
+func (self Value) IsArray() bool {
+	return self.Type == ArrayType
+}
+
+// IsScalar reports whether the value is a string, integer, real, boolean,
+// data, date, UID or null value.
+func (self Value) IsScalar() bool {
+	return self.IsValid() && !self.IsDict() && !self.IsArray()
+}
+
+// IsValid reports whether the value has a known type other than InvalidType.
+func (self Value) IsValid() bool {
+	return self.Type > InvalidType && self.Type < typeCount
+}
+
 // InvalidValue is a conenience pre-initialized constant to return on errors.
 var InvalidValue = Value{nil, InvalidType}
 
-const preamble = xml.Header + `<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
-`
+// NullValue is the value of NullType.
+var NullValue = Value{nil, NullType}
 
 // Write writes the plist representation of this Value instance to writer.
+// The output is complete when Write returns without error, but when writer
+// buffers itself, e.g. a *bufio.Writer, the caller must still flush it. The
+// first error of writer, e.g. io.ErrClosedPipe once the reading side of an
+// io.Pipe is closed, ends writing and is returned without walking the rest
+// of the value.
+//
+// The output is deterministic: equal trees produce identical bytes, however
+// their maps were built, since dict keys are always written sorted.
 func (self Value) Write(writer io.Writer) error {
-	if _, err := io.WriteString(writer, preamble); err != nil {
-		return err
-	}
-	encoder := xml.NewEncoder(writer)
-	elem := xml.StartElement{Name: xml.Name{Local: "plist"}, Attr: []xml.Attr{{Name: xml.Name{Space: "", Local: "version"}, Value: "1.0"}}}
-	encoder.Indent("", "  ")
-	if err := encoder.EncodeToken(elem); err != nil {
-		return err
-	}
-	if err := self.writeXml(encoder); err != nil {
-		return err
-	}
-	if err := encoder.EncodeToken(elem.End()); err != nil {
-		return err
+	return self.WriteContext(context.Background(), writer)
+}
+
+// WriteContext writes the plist representation like Write, but stops with
+// ctx.Err() when ctx is done, see Encoder.EncodeContext.
+func (self Value) WriteContext(ctx context.Context, writer io.Writer) error {
+	encoder := getEncoder()
+	defer encoder.release()
+	return encoder.encode(ctx, self, writer)
+}
+
+// WriteTo implements io.WriterTo, writing the plist representation like Write
+// and returning the number of bytes written to writer.
+func (self Value) WriteTo(writer io.Writer) (int64, error) {
+	encoder := getEncoder()
+	defer encoder.release()
+	encoder.counter.writer = writer
+	err := encoder.encode(context.Background(), self, &encoder.counter)
+	return encoder.counter.n, err
+}
+
+// Format identifies a plist encoding.
+type Format int
+
+const (
+	// XMLFormat is the XML property list format read and written by this
+	// package.
+	XMLFormat Format = iota
+	// BinaryFormat is the bplist00 format, which cannot be written yet.
+	BinaryFormat
+)
+
+// EncodedSize returns the number of bytes Write would produce for format,
+// without keeping the output.
+func (self Value) EncodedSize(format Format) (int, error) {
+	if format != XMLFormat {
+		return 0, fmt.Errorf("Unsupported format %d", format)
 	}
-	return encoder.Flush()
+	n, err := self.WriteTo(io.Discard)
+	return int(n), err
 }
 
-func encodeElem(encoder *xml.Encoder, value interface{}, name string) error {
-	return encoder.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+// Bytes returns the plist representation of this Value as Write writes it.
+func (self Value) Bytes() ([]byte, error) {
+	encoder := getEncoder()
+	defer encoder.release()
+	if err := encoder.encode(context.Background(), self, &encoder.buffer); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(encoder.buffer.Bytes()), nil
 }
 
-func (self Value) writeXml(encoder *xml.Encoder) error {
-	switch self.Type {
-	case ArrayType:
-		elem := xml.StartElement{Name: xml.Name{Local: "array"}}
-		if err := encoder.EncodeToken(elem); err != nil {
-			return err
-		}
-		for _, v := range self.Value.([]Value) {
-			if err := v.writeXml(encoder); err != nil {
-				return err
-			}
-		}
-		return encoder.EncodeToken(elem.End())
-	case DictType:
-		elem := xml.StartElement{Name: xml.Name{Local: "dict"}}
-		if err := encoder.EncodeToken(elem); err != nil {
-			return err
-		}
-		m := self.Value.(map[string]Value)
-		keys := make([]string, 0, len(m))
-		for key := range m {
-			keys = append(keys, key)
-		}
-		sort.Strings(keys)
+// XMLString returns the plist representation of this Value as Write writes
+// it.
+func (self Value) XMLString() (string, error) {
+	encoder := getEncoder()
+	defer encoder.release()
+	if err := encoder.encode(context.Background(), self, &encoder.buffer); err != nil {
+		return "", err
+	}
+	return encoder.buffer.String(), nil
+}
 
-		for _, k := range keys {
-			if err := encodeElem(encoder, k, "key"); err != nil {
-				return err
-			}
-			if err := m[k].writeXml(encoder); err != nil {
-				return err
-			}
-		}
-		return encoder.EncodeToken(elem.End())
-	case StringType:
-		return encodeElem(encoder, self.Value, "string")
-	case IntegerType:
-		return encodeElem(encoder, self.Value, "integer")
-	case RealType:
-		return encodeElem(encoder, self.Value, "real")
-	case DataType:
-		return encodeElem(encoder, base64.StdEncoding.EncodeToString(self.Value.([]byte)), "data")
-	case DateType:
-		return encodeElem(encoder, self.Value, "date")
-	case BooleanType:
-		if !self.Value.(bool) {
-			return encodeElem(encoder, "", "false")
-		} else {
-			return encodeElem(encoder, "", "true")
-		}
+// WriteFile writes the plist representation of value to the file name,
+// creating or truncating it with permissions perm. Errors from writing,
+// flushing and closing the file are all reported.
+func WriteFile(name string, value Value, perm os.FileMode) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
 	}
-	return InvalidTypeError
+	if err := value.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
 
 // Raw returns a pure golang structure of the value data instead of Value wrapped objects.
-// Dicts become map[string]interface{} and arrays []interface{}
+// Dicts become map[string]interface{}, also when decoded as *OrderedDict, and arrays []interface{}
 // Otherwise the value types stay as defined.
 func (self Value) Raw() interface{} {
 	switch self.Type {
@@ -190,42 +275,279 @@ func (self Value) Raw() interface{} {
 		return result
 	case DictType:
 		result := map[string]interface{}{}
-		for k, v := range self.Value.(map[string]Value) {
+		for k, v := range self.dictMap() {
 			result[k] = v.Raw()
 		}
 		return result
+	case DataType:
+		return self.data()
 	default:
 		return self.Value
 	}
 }
 
+// asciiCharsets lists the encoding labels which are subsets of UTF-8 and can
+// therefore be read without conversion.
+var asciiCharsets = map[string]bool{
+	"us-ascii":       true,
+	"ascii":          true,
+	"ansi_x3.4-1968": true,
+	"iso646-us":      true,
+	"utf8":           true,
+}
+
+// isASCIICharset reports whether charset only allows ASCII characters.
+func isASCIICharset(charset string) bool {
+	charset = strings.ToLower(charset)
+	return asciiCharsets[charset] && charset != "utf8"
+}
+
+// declaredEncoding returns the value of the encoding pseudo-attribute of the
+// XML declaration content inst, or "" if it has none.
+func declaredEncoding(inst string) string {
+	i := strings.Index(inst, "encoding")
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(inst[i+len("encoding"):], " \t\r\n")
+	if !strings.HasPrefix(rest, "=") {
+		return ""
+	}
+	rest = strings.TrimLeft(rest[1:], " \t\r\n")
+	if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+		return ""
+	}
+	end := strings.IndexByte(rest[1:], rest[0])
+	if end < 0 {
+		return ""
+	}
+	return rest[1 : end+1]
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if asciiCharsets[strings.ToLower(charset)] {
+		return input, nil
+	}
+	return nil, fmt.Errorf("Unsupported encoding %s", charset)
+}
+
 // Read parses a plist xml representation from reader.
+// The DOCTYPE declaration is optional, the XML declaration may specify UTF-8 or
+// US-ASCII as encoding and may be preceded by a UTF-8 byte order mark. Binary
+// plists are rejected with an error wrapping ErrUnsupportedFormat.
 func Read(reader io.Reader) (Value, error) {
-	decoder := xml.NewDecoder(reader)
+	return NewDecoder(reader).Decode()
+}
+
+// Parse parses the plist document in data like Read.
+func Parse(data []byte) (Value, error) {
+	return Read(bytes.NewReader(data))
+}
+
+// ParseString parses the plist document in s like Read.
+func ParseString(s string) (Value, error) {
+	return Read(strings.NewReader(s))
+}
+
+// readPrologue consumes the tokens up to and including the plist start element.
+func (self *Decoder) readPrologue() error {
+	decoder := self.decoder
+	if decoder.InputOffset() == 0 {
+		// Skip a UTF-8 byte order mark as written by Windows editors.
+		if bom, _ := self.buffered.Peek(len(utf8BOM)); string(bom) == utf8BOM {
+			self.buffered.Discard(len(utf8BOM))
+		}
+		if magic, _ := self.buffered.Peek(len(binaryMagic) + 2); bytes.HasPrefix(magic, []byte(binaryMagic)) {
+			return plistErrorFromError(0, fmt.Errorf("%w: binary plist version %q", ErrUnsupportedFormat, magic[len(binaryMagic):]))
+		}
+	}
 	for {
-		if token, err := decoder.Token(); err != nil {
-			return InvalidValue, err
+		if token, err := decoder.Token(); err == io.EOF {
+			// No further document.
+			return err
+		} else if err != nil {
+			return plistErrorFromError(self.inputOffset(), err)
 		} else {
-			if element, ok := token.(xml.StartElement); ok {
-				if element.Name.Local != "plist" {
-					return InvalidValue, plistErrorFromError(decoder.InputOffset(), fmt.Errorf("Unexpected element %s", element.Name.Local))
+			switch token := token.(type) {
+			case xml.ProcInst:
+				if token.Target != "xml" && self.Prologue == StrictPrologue {
+					return plistErrorFromError(self.inputOffset(), fmt.Errorf("Unexpected processing instruction %s", token.Target))
+				}
+				self.recordDeclaration(token)
+			case xml.Directive:
+				if !self.AllowDirectives && !plainDoctype(token) {
+					return plistErrorFromError(self.inputOffset(), fmt.Errorf("Unexpected directive <!%.20s>", token))
+				}
+			case xml.Comment:
+				if self.Prologue == StrictPrologue {
+					return plistErrorFromError(self.inputOffset(), fmt.Errorf("Unexpected comment before the plist element"))
+				}
+			case xml.CharData:
+				if text := bytes.TrimLeft(token, " \t\r\n"); len(text) > 0 && self.Prologue == StrictPrologue {
+					return plistErrorFromError(self.inputOffset(), fmt.Errorf("Unexpected text %.20q before the plist element", text))
+				}
+			case xml.StartElement:
+				if token.Name.Local == "plist" {
+					self.recordAttributes(token, true)
+					return nil
 				}
-				break
+				if self.Prologue != SkipUnknownElements {
+					return plistErrorFromError(self.inputOffset(), fmt.Errorf("Unexpected element %s", token.Name.Local))
+				}
+				if err := decoder.Skip(); err != nil {
+					return plistErrorFromError(self.inputOffset(), err)
+				}
+			}
+		}
+	}
+}
+
+// plainDoctype reports whether directive is a DOCTYPE without an internal
+// subset. Brackets within quoted identifiers do not start a subset.
+func plainDoctype(directive xml.Directive) bool {
+	if !bytes.HasPrefix(directive, []byte("DOCTYPE")) {
+		return false
+	}
+	var quote byte
+	for _, c := range directive {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
 			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			return false
 		}
 	}
-	return readValue(decoder)
+	return true
+}
+
+func (self *Decoder) readDocument() (Value, error) {
+	if err := self.readPrologue(); err != nil {
+		return InvalidValue, err
+	}
+	value, err := self.readValue(func() error { return fmt.Errorf("Plist element has no value") })
+	if err != nil {
+		return InvalidValue, err
+	}
+	return value, self.readDocumentEnd()
+}
+
+// readDocumentEnd consumes the tokens up to the end of the plist element, so
+// the next document of the stream can be read.
+func (self *Decoder) readDocumentEnd() error {
+	decoder := self.decoder
+	for {
+		if token, err := decoder.Token(); err != nil {
+			return plistErrorFromError(self.inputOffset(), err)
+		} else {
+			switch element := token.(type) {
+			case xml.EndElement:
+				return nil
+			case xml.StartElement:
+				return plistErrorFromError(self.inputOffset(), fmt.Errorf("Unexpected element %s after the root value", element.Name.Local))
+			}
+		}
+	}
+}
+
+// base64DecodedLen returns the number of bytes the base64 text s without
+// whitespace decodes to, with or without padding.
+func base64DecodedLen(s string) int {
+	return base64.RawStdEncoding.DecodedLen(len(strings.TrimRight(s, "=")))
+}
+
+// decodeBase64 decodes s with encoding. Text with missing or extra '='
+// padding, which encoding rejects, is decoded again without padding. The
+// error of encoding names the offending text.
+func decodeBase64(encoding *base64.Encoding, s string) ([]byte, error) {
+	data, err := encoding.DecodeString(s)
+	if err == nil {
+		return data, nil
+	}
+	if data, rawErr := encoding.WithPadding(base64.NoPadding).DecodeString(strings.TrimRight(s, "=")); rawErr == nil {
+		return data, nil
+	}
+	if corrupt, ok := err.(base64.CorruptInputError); ok {
+		start, end := max(0, int(corrupt)-8), min(len(s), int(corrupt)+8)
+		return nil, fmt.Errorf("Invalid base64 data at %d near %q: %w", int(corrupt), s[start:end], err)
+	}
+	return nil, fmt.Errorf("Invalid base64 data: %w", err)
+}
+
+// decodeLenientBase64 decodes s with encoding, then with the URL-safe
+// alphabet, and then both again with the characters stripBase64 removes. It
+// returns the error of encoding for s if none succeeds.
+func decodeLenientBase64(encoding *base64.Encoding, s string) ([]byte, error) {
+	data, err := decodeBase64(encoding, s)
+	if err == nil {
+		return data, nil
+	}
+	if data, urlErr := decodeBase64(base64.URLEncoding, s); urlErr == nil {
+		return data, nil
+	}
+	if stripped := stripBase64(s); stripped != s {
+		if data, strippedErr := decodeLenientBase64(encoding, stripped); strippedErr == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// stripBase64 removes the characters of s which are neither letters, digits
+// nor one of "+/-_=", which no standard or URL-safe base64 text contains.
+func stripBase64(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'A' <= r && r <= 'Z', 'a' <= r && r <= 'z', '0' <= r && r <= '9', strings.ContainsRune("+/-_=", r):
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// dateLayouts lists the accepted date formats in the order they are tried:
+// RFC 3339 as written by CoreFoundation first, with optional fractional
+// seconds, then the fallbacks for offsets without a colon and the GNUstep
+// format "2016-11-01 08:46:41 +0000".
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02 15:04:05 -0700"}
+
+// lenientDateLayouts lists the formats accepted with LenientDates in addition
+// to dateLayouts.
+var lenientDateLayouts = []string{"2006-01-02T15:04Z07:00", "2006-01-02"}
+
+// parseDate parses s with the first matching of dateLayouts, or with RFC 3339
+// only if StrictDates is set. The offset of s is kept as the location of the
+// date.
+func (self *Decoder) parseDate(s string) (time.Time, error) {
+	layouts := dateLayouts
+	if self.StrictDates {
+		layouts = layouts[:1]
+	} else if self.LenientDates {
+		layouts = append(layouts[:len(layouts):len(layouts)], lenientDateLayouts...)
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid date %q, expected one of the layouts %q", s, layouts)
 }
 
 type decodeFilter func(string) (Value, error)
 
-func elementDecoder(decoder *xml.Decoder, element xml.StartElement) func(decodeFilter) (Value, error) {
+func (self *Decoder) elementDecoder(element xml.StartElement) func(decodeFilter) (Value, error) {
+	decoder := self.decoder
 	return func(filter decodeFilter) (Value, error) {
 		var data xml.CharData
 		if err := decoder.DecodeElement(&data, &element); err != nil {
-			return InvalidValue, err
+			return InvalidValue, plistErrorFromError(self.inputOffset(), err)
+		} else if value, err := filter(string(data)); err != nil {
+			return InvalidValue, withOffset(self.inputOffset(), err)
 		} else {
-			return filter(string(data))
+			return value, nil
 		}
 	}
 }
@@ -243,91 +565,215 @@ func valueWrap(valueType ValueType) func(value interface{}, err error) (Value, e
 	}
 }
 
-func parseElement(decoder *xml.Decoder, element xml.StartElement) (Value, error) {
-	decodeData := elementDecoder(decoder, element)
-	switch element.Name.Local {
+// scalarFilter returns the filter converting the text of the scalar element
+// name, or nil if name is not a scalar element with text content.
+func (self *Decoder) scalarFilter(name string) decodeFilter {
+	switch name {
 	case "string":
-		return decodeData(nullFilter)
+		if self.MaxStringBytes > 0 {
+			return func(s string) (Value, error) {
+				if len(s) > self.MaxStringBytes {
+					return InvalidValue, self.limitError("MaxStringBytes", self.MaxStringBytes)
+				}
+				return nullFilter(s)
+			}
+		}
+		return nullFilter
 	case "date":
-		return decodeData(func(s string) (Value, error) {
-			return valueWrap(DateType)(time.ParseInLocation(time.RFC3339, s, time.UTC))
-		})
+		return func(s string) (Value, error) {
+			return valueWrap(DateType)(self.parseDate(s))
+		}
 	case "integer":
-		return decodeData(func(s string) (Value, error) {
-			if len(s) > 2 && strings.ToLower(s[:2]) == "0x" {
-				return valueWrap(IntegerType)(strconv.ParseInt(s[2:], 16, 64))
-			}
-			return valueWrap(IntegerType)(strconv.ParseInt(s, 10, 64))
-		})
+		return parseInteger
 	case "real":
-		return decodeData(func(s string) (Value, error) {
+		return func(s string) (Value, error) {
 			return valueWrap(RealType)(strconv.ParseFloat(s, 64))
-		})
+		}
+	case "data":
+		return func(s string) (Value, error) {
+			s = whitespaceReplacer.Replace(s)
+			encoding := self.dataEncoding()
+			if self.MaxDataBytes > 0 && base64DecodedLen(s) > self.MaxDataBytes {
+				return InvalidValue, self.limitError("MaxDataBytes", self.MaxDataBytes)
+			}
+			if self.LazyData {
+				return self.lazyData(encoding, s)
+			} else if self.LenientData {
+				return valueWrap(DataType)(decodeLenientBase64(encoding, s))
+			}
+			return valueWrap(DataType)(decodeBase64(encoding, s))
+		}
+	}
+	return nil
+}
+
+func (self *Decoder) parseElement(element xml.StartElement) (Value, error) {
+	decoder := self.decoder
+	if self.values++; self.MaxTotalValues > 0 && self.values > self.MaxTotalValues {
+		return InvalidValue, self.limitError("MaxTotalValues", self.MaxTotalValues)
+	}
+	self.recordAttributes(element, false)
+	self.attachComments()
+	if element.Name.Local == "data" && self.source != nil {
+		return self.streamData(element)
+	}
+	if filter := self.scalarFilter(element.Name.Local); filter != nil {
+		if self.metadata != nil && self.PreserveNumberText && (element.Name.Local == "integer" || element.Name.Local == "real") {
+			scalar := filter
+			filter = func(s string) (Value, error) {
+				value, err := scalar(s)
+				if err == nil {
+					self.metadata.numbers[joinPath(self.path)] = numberText{s, value}
+				}
+				return value, err
+			}
+		}
+		value, err := self.elementDecoder(element)(filter)
+		if err == nil && value.Type == IntegerType && self.booleanPaths != nil && self.booleanPaths[joinPath(self.path)] {
+			if i, _, large := value.integer(); !large && (i == 0 || i == 1) {
+				value = Value{i == 1, BooleanType}
+			}
+		}
+		return value, err
+	}
+	switch element.Name.Local {
 	case "true", "false":
 		decoder.Skip()
 		return valueWrap(BooleanType)(strings.ToLower(element.Name.Local) == "true", nil)
-	case "data":
-		return decodeData(func(s string) (Value, error) {
-			return valueWrap(DataType)(base64.StdEncoding.DecodeString(whitespaceReplacer.Replace(s)))
-		})
 	case "dict":
+		if err := self.enter(); err != nil {
+			return InvalidValue, err
+		}
+		defer self.leave()
 		result := map[string]Value{}
+		var ordered *OrderedDict
+		// originals maps transformed keys to the keys in the document.
+		var originals map[string]string
+		if self.OrderedDicts {
+			ordered = &OrderedDict{Map: result}
+		}
 		for {
 			if token, err := decoder.Token(); err == nil {
-				if element, ok := token.(xml.EndElement); ok {
+				if comment, ok := token.(xml.Comment); ok {
+					self.recordComment(comment)
+				} else if element, ok := token.(xml.EndElement); ok {
 					if element.Name.Local == "dict" {
-						return Value{result, DictType}, nil
+						self.attachTrailingComments()
+						value := Value{result, DictType}
+						if ordered != nil {
+							value = Value{ordered, DictType}
+						}
+						if self.DecodeUIDs {
+							value = collapseUID(value)
+						}
+						return value, nil
 					}
 				} else if element, ok := token.(xml.StartElement); ok {
 					if element.Name.Local == "key" {
-						if key, err := elementDecoder(decoder, element)(nullFilter); err != nil {
+						// Keys hold text only, a nested element is an error rather
+						// than an empty or non-string key.
+						if key, err := self.elementText(element); err != nil {
 							return InvalidValue, err
+						} else if self.MaxStringBytes > 0 && len(key) > self.MaxStringBytes {
+							return InvalidValue, self.limitError("MaxStringBytes", self.MaxStringBytes)
 						} else {
-							if value, err := readValue(decoder); err != nil {
+							original := key
+							if self.KeyTransform != nil {
+								if originals == nil {
+									originals = map[string]string{}
+								}
+								key = self.KeyTransform(key)
+							}
+							policy := LastKeyWins
+							if _, ok := result[key]; ok {
+								policy = self.DuplicateKeys
+								if self.KeyTransform != nil && originals[key] != original {
+									policy = self.KeyCollisions
+								}
+								if policy == RejectDuplicateKeys {
+									return InvalidValue, plistErrorFromError(self.inputOffset(), &DuplicateKeyError{Path: joinPath(self.path), Key: key})
+								}
+							} else if self.MaxCollectionElements > 0 && len(result) >= self.MaxCollectionElements {
+								return InvalidValue, self.limitError("MaxCollectionElements", self.MaxCollectionElements)
+							} else if originals != nil {
+								originals[key] = original
+							}
+							self.path = append(self.path, key)
+							value, err := self.readValue(func() error { return fmt.Errorf("Key %q has no value", original) })
+							self.path = self.path[:len(self.path)-1]
+							if err != nil {
 								return InvalidValue, err
-							} else {
-								result[key.Value.(string)] = value
+							} else if policy != FirstKeyWins {
+								if ordered != nil {
+									ordered.Set(key, value)
+								} else {
+									result[key] = value
+								}
 							}
 						}
 					} else {
-						return InvalidValue, fmt.Errorf("Unexpected element '%s' at %d", element.Name.Local, decoder.InputOffset())
+						return InvalidValue, fmt.Errorf("Unexpected element '%s' at %d", element.Name.Local, self.inputOffset())
 					}
 				}
 			} else {
-				return InvalidValue, err
+				return InvalidValue, plistErrorFromError(self.inputOffset(), err)
 			}
 		}
 	case "array":
+		if err := self.enter(); err != nil {
+			return InvalidValue, err
+		}
+		defer self.leave()
 		result := []Value{}
 		for {
 			if token, err := decoder.Token(); err == nil {
-				if element, ok := token.(xml.EndElement); ok {
+				if comment, ok := token.(xml.Comment); ok {
+					self.recordComment(comment)
+				} else if element, ok := token.(xml.EndElement); ok {
 					if element.Name.Local == "array" {
+						self.attachTrailingComments()
 						return Value{result, ArrayType}, nil
 					}
 				} else if element, ok := token.(xml.StartElement); ok {
-					if value, err := parseElement(decoder, element); err != nil {
+					if self.MaxCollectionElements > 0 && len(result) >= self.MaxCollectionElements {
+						return InvalidValue, self.limitError("MaxCollectionElements", self.MaxCollectionElements)
+					}
+					self.path = append(self.path, strconv.Itoa(len(result)))
+					value, err := self.parseElement(element)
+					self.path = self.path[:len(self.path)-1]
+					if err != nil {
 						return InvalidValue, err
 					} else {
 						result = append(result, value)
 					}
 				}
 			} else {
-				return InvalidValue, err
+				return InvalidValue, plistErrorFromError(self.inputOffset(), err)
 			}
 		}
 	}
-	return InvalidValue, fmt.Errorf("Unsupported element %s at %d", element.Name.Local, decoder.InputOffset())
+	return InvalidValue, fmt.Errorf("Unsupported element %s at %d", element.Name.Local, self.inputOffset())
 }
 
-func readValue(decoder *xml.Decoder) (Value, error) {
+// readValue reads the next value element. Reaching the end of the enclosing
+// element or a key first fails with the error returned by missing.
+func (self *Decoder) readValue(missing func() error) (Value, error) {
+	decoder := self.decoder
 	for {
 		if token, err := decoder.Token(); err == nil {
-			if element, ok := token.(xml.StartElement); ok {
-				return parseElement(decoder, element)
+			switch element := token.(type) {
+			case xml.StartElement:
+				if element.Name.Local == "key" {
+					return InvalidValue, plistErrorFromError(self.inputOffset(), missing())
+				}
+				return self.parseElement(element)
+			case xml.EndElement:
+				return InvalidValue, plistErrorFromError(self.inputOffset(), missing())
+			case xml.Comment:
+				self.recordComment(element)
 			}
 		} else {
-			return InvalidValue, plistErrorFromError(decoder.InputOffset(), err)
+			return InvalidValue, plistErrorFromError(self.inputOffset(), err)
 		}
 	}
 	return InvalidValue, fmt.Errorf("Unknown error")
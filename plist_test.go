@@ -0,0 +1,867 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func mustRead(t *testing.T, data string) plist.Value {
+	t.Helper()
+	value, err := plist.Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	return value
+}
+
+func TestReadWithoutDoctype(t *testing.T) {
+	value := mustRead(t, `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict><key>Name</key><string>value</string></dict>
+</plist>`)
+	if value.Type != plist.DictType {
+		t.Fatalf("expected dict, got %s", value.Type.Name())
+	}
+	if name := value.Value.(map[string]plist.Value)["Name"]; name.Value != "value" {
+		t.Errorf("unexpected Name %v", name.Value)
+	}
+}
+
+func TestReadWithoutDeclaration(t *testing.T) {
+	value := mustRead(t, `<plist version="1.0"><string>bare</string></plist>`)
+	if value.Value != "bare" {
+		t.Errorf("unexpected value %v", value.Value)
+	}
+}
+
+func TestReadCustomDoctype(t *testing.T) {
+	value := mustRead(t, `<?xml version="1.0"?>
+<!DOCTYPE plist SYSTEM "file://localhost/System/Library/DTDs/PropertyList.dtd">
+<plist version="0.9"><integer>42</integer></plist>`)
+	if value.Value != int64(42) {
+		t.Errorf("unexpected value %v", value.Value)
+	}
+}
+
+func TestReadUSASCIIEncoding(t *testing.T) {
+	value := mustRead(t, `<?xml version="1.0" encoding="US-ASCII"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><string>ascii &#220;</string></plist>`)
+	if value.Value != "ascii Ü" {
+		t.Errorf("unexpected value %q", value.Value)
+	}
+}
+
+func TestReadUnsupportedEncoding(t *testing.T) {
+	_, err := plist.Read(strings.NewReader(`<?xml version="1.0" encoding="EBCDIC"?><plist><string/></plist>`))
+	if err == nil {
+		t.Errorf("expected an error for an unsupported encoding")
+	}
+}
+
+func TestDecoderCustomEntity(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(`<plist version="1.0"><string>&company; Inc.</string></plist>`))
+	decoder.Entity = map[string]string{"company": "Example"}
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if value.Value != "Example Inc." {
+		t.Errorf("unexpected value %q", value.Value)
+	}
+
+	if _, err := plist.Read(strings.NewReader(`<plist version="1.0"><string>&company;</string></plist>`)); err == nil {
+		t.Errorf("expected an error for an unknown entity in strict mode")
+	}
+}
+
+func TestDecoderRelaxedXML(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(`<plist version="1.0"><string>AT&T &unknown;</string></plist>`))
+	decoder.RelaxedXML = true
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if value.Value != "AT&T &unknown;" {
+		t.Errorf("unexpected value %q", value.Value)
+	}
+}
+
+func TestReadNamespacedPlist(t *testing.T) {
+	value := mustRead(t, `<plist xmlns="http://www.apple.com/DTDs/PropertyList-1.0.dtd" version="1.0"><true/></plist>`)
+	if value.Value != true {
+		t.Errorf("unexpected value %v", value.Value)
+	}
+}
+
+func TestDecoderMaxDataBytes(t *testing.T) {
+	const document = `<plist version="1.0"><array><data>AAECAwQ=</data><data>
+	AAECAwQFBgc=
+	</data></array></plist>`
+	decoder := plist.NewDecoder(strings.NewReader(document))
+	decoder.MaxDataBytes = 8
+	if _, err := decoder.Decode(); err != nil {
+		t.Errorf("Decode failed at the limit: %s", err)
+	}
+
+	decoder = plist.NewDecoder(strings.NewReader(document))
+	decoder.MaxDataBytes = 7
+	if _, err := decoder.Decode(); err == nil {
+		t.Errorf("expected an error for data exceeding the limit")
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	const document = `<plist><dict><key>name</key><string>value</string><key>list</key><array><integer>1</integer><true/></array></dict></plist>`
+	for _, test := range []struct {
+		limit string
+		set   func(*plist.Decoder, int)
+		max   int
+		// tripped ends where the limit trips, empty if it does not.
+		tripped string
+	}{
+		{"MaxStringBytes", func(d *plist.Decoder, n int) { d.MaxStringBytes = n }, 3, `<key>name</key>`},
+		{"MaxStringBytes", func(d *plist.Decoder, n int) { d.MaxStringBytes = n }, 4, `<string>value</string>`},
+		{"MaxCollectionElements", func(d *plist.Decoder, n int) { d.MaxCollectionElements = n }, 2, ""},
+		{"MaxCollectionElements", func(d *plist.Decoder, n int) { d.MaxCollectionElements = n }, 1, `<key>list</key>`},
+		{"MaxTotalValues", func(d *plist.Decoder, n int) { d.MaxTotalValues = n }, 5, ""},
+		{"MaxTotalValues", func(d *plist.Decoder, n int) { d.MaxTotalValues = n }, 4, `<true/>`},
+	} {
+		decoder := plist.NewDecoder(strings.NewReader(document))
+		test.set(decoder, test.max)
+		_, err := decoder.Decode()
+		if test.tripped == "" {
+			if err != nil {
+				t.Errorf("%s %d: Decode failed at the limit: %s", test.limit, test.max, err)
+			}
+			continue
+		}
+		var limitError *plist.LimitError
+		if !errors.As(err, &limitError) || limitError.Limit != test.limit || limitError.Max != test.max {
+			t.Errorf("%s %d: expected a LimitError, got %v", test.limit, test.max, err)
+			continue
+		}
+		offset := strings.Index(document, test.tripped) + len(test.tripped)
+		if !strings.Contains(err.Error(), "line: "+strconv.Itoa(offset)+":") {
+			t.Errorf("%s %d: expected the offset %d in %q", test.limit, test.max, offset, err)
+		}
+	}
+}
+
+// nestedDocument returns a document with depth dicts and arrays nested in
+// the order given by seed.
+func nestedDocument(depth int, seed int64) string {
+	random := rand.New(rand.NewSource(seed))
+	var open, close strings.Builder
+	closing := make([]string, 0, depth)
+	for i := 0; i < depth; i++ {
+		if random.Intn(2) == 0 {
+			open.WriteString("<array>")
+			closing = append(closing, "</array>")
+		} else {
+			open.WriteString("<dict><key>k</key>")
+			closing = append(closing, "</dict>")
+		}
+	}
+	for i := len(closing) - 1; i >= 0; i-- {
+		close.WriteString(closing[i])
+	}
+	return "<plist>" + open.String() + "<true/>" + close.String() + "</plist>"
+}
+
+func TestDecoderMaxDepth(t *testing.T) {
+	for seed := int64(0); seed < 4; seed++ {
+		document := nestedDocument(100000, seed)
+		if _, err := plist.Read(strings.NewReader(document)); !errors.Is(err, plist.ErrTooDeep) {
+			t.Errorf("seed %d: expected ErrTooDeep, got %v", seed, err)
+		}
+		if err := plist.Validate(strings.NewReader(document)); !errors.Is(err, plist.ErrTooDeep) {
+			t.Errorf("seed %d: expected ErrTooDeep from Validate, got %v", seed, err)
+		}
+	}
+
+	if _, err := plist.Read(strings.NewReader(nestedDocument(plist.DefaultMaxDepth, 1))); err != nil {
+		t.Errorf("Read failed at the default limit: %s", err)
+	}
+
+	const document = `<plist><array><array><array><array><true/></array></array></array></array></plist>`
+	decoder := plist.NewDecoder(strings.NewReader(document))
+	decoder.MaxDepth = 4
+	if _, err := decoder.Decode(); err != nil {
+		t.Errorf("Decode failed at the limit: %s", err)
+	}
+	decoder = plist.NewDecoder(strings.NewReader(document))
+	decoder.MaxDepth = 3
+	// The error is reported after the start tag of the fourth array.
+	offset := strconv.Itoa(len("<plist>") + 4*len("<array>"))
+	if _, err := decoder.Decode(); !errors.Is(err, plist.ErrTooDeep) {
+		t.Errorf("expected ErrTooDeep, got %v", err)
+	} else if !strings.Contains(err.Error(), "line: "+offset+":") {
+		t.Errorf("expected the offset %s in %q", offset, err)
+	}
+
+	decoder = plist.NewDecoder(strings.NewReader(nestedDocument(2*plist.DefaultMaxDepth, 3)))
+	decoder.MaxDepth = -1
+	if _, err := decoder.Decode(); err != nil {
+		t.Errorf("Decode failed without a limit: %s", err)
+	}
+}
+
+func TestReadBinaryPlist(t *testing.T) {
+	for _, version := range []string{"00", "15", "16"} {
+		data := []byte("bplist" + version + "\x00\x08\xd0\x00\x00\x00")
+		if _, err := plist.Parse(data); !errors.Is(err, plist.ErrUnsupportedFormat) {
+			t.Errorf("expected ErrUnsupportedFormat for version %s, got %v", version, err)
+		} else if !strings.Contains(err.Error(), `version "`+version+`"`) {
+			t.Errorf("expected the version %s in %q", version, err)
+		}
+		if err := plist.Validate(bytes.NewReader(data)); !errors.Is(err, plist.ErrUnsupportedFormat) {
+			t.Errorf("expected ErrUnsupportedFormat from Validate, got %v", err)
+		}
+		var v interface{}
+		if format, err := plist.Unmarshal(data, &v); format != plist.BinaryFormat || err == nil {
+			t.Errorf("expected BinaryFormat and an error, got %v, %v", format, err)
+		}
+	}
+}
+
+// billionLaughs declares entities each expanding to ten of the previous one.
+const billionLaughs = `<?xml version="1.0"?>
+<!DOCTYPE plist [
+  <!ENTITY lol "lol">
+  <!ENTITY lol1 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+  <!ENTITY lol2 "&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;">
+  <!ENTITY lol3 "&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;">
+  <!ENTITY lol9 "&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;">
+]>
+<plist version="1.0"><string>&lol9;</string></plist>`
+
+func TestReadRejectsDirectives(t *testing.T) {
+	for _, document := range []string{
+		billionLaughs,
+		`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd" [<!ENTITY x "y">]><plist><string>&x;</string></plist>`,
+		`<!DOCTYPE plist SYSTEM "file:///etc/passwd" [<!ENTITY % remote SYSTEM "http://example.com/x.dtd"> %remote;]><plist><true/></plist>`,
+		`<!ENTITY x "y"><plist><true/></plist>`,
+	} {
+		_, err := plist.Read(strings.NewReader(document))
+		if err == nil || !strings.Contains(err.Error(), "Unexpected") {
+			t.Errorf("expected an error for %.40q, got %v", document, err)
+		}
+		// The error is raised before the plist element is read.
+		var offset int
+		if _, scanErr := fmt.Sscanf(fmt.Sprint(err), "PList error line: %d:", &offset); scanErr != nil || offset > strings.Index(document, "<plist") {
+			t.Errorf("expected an error before the plist element, got %v", err)
+		}
+		if err := plist.Validate(strings.NewReader(document)); err == nil {
+			t.Errorf("expected Validate to fail for %.40q", document)
+		}
+	}
+
+	decoder := plist.NewDecoder(strings.NewReader(`<!DOCTYPE plist [<!ENTITY x "y">]><plist><true/></plist>`))
+	decoder.AllowDirectives = true
+	if value, err := decoder.Decode(); err != nil || value.Value != true {
+		t.Errorf("unexpected result %v, %v", value, err)
+	}
+	mustRead(t, `<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN [x]" "http://www.apple.com/DTDs/PropertyList-1.0.dtd"><plist><true/></plist>`)
+}
+
+func TestReadPrologueModes(t *testing.T) {
+	const declaration = "<?xml version=\"1.0\"?>\n<!DOCTYPE plist>\n"
+	tests := []struct {
+		prologue                     string
+		lenient, strict, skipUnknown bool
+	}{
+		{"", true, true, true},
+		{"<!-- generated -->\n", true, false, true},
+		{"stray text\n", true, false, true},
+		{"<?xml-stylesheet href=\"style.xsl\"?>\n", true, false, true},
+		{"<meta><plist><false/></plist></meta>\n", false, false, true},
+	}
+	for _, test := range tests {
+		document := declaration + test.prologue + "<plist><true/></plist>"
+		for mode, accepted := range map[plist.PrologueMode]bool{
+			plist.LenientPrologue:     test.lenient,
+			plist.StrictPrologue:      test.strict,
+			plist.SkipUnknownElements: test.skipUnknown,
+		} {
+			decoder := plist.NewDecoder(strings.NewReader(document))
+			decoder.Prologue = mode
+			value, err := decoder.Decode()
+			if accepted && (err != nil || value.Value != true) {
+				t.Errorf("mode %d: unexpected result %v, %v for %q", mode, value, err, test.prologue)
+			} else if !accepted && (err == nil || !strings.Contains(err.Error(), "Unexpected")) {
+				t.Errorf("mode %d: expected an error for %q, got %v", mode, test.prologue, err)
+			}
+		}
+	}
+}
+
+func TestReadDataLineBreaks(t *testing.T) {
+	expected := []byte("The quick brown fox jumps over the lazy dog")
+	for name, text := range map[string]string{
+		"LF":          "\n\tVGhlIHF1aWNrIGJyb3du\n\tIGZveCBqdW1wcyBvdmVy\n\tIHRoZSBsYXp5IGRvZw==\n\t",
+		"CRLF":        "\r\n\tVGhlIHF1aWNrIGJyb3du\r\n\tIGZveCBqdW1wcyBvdmVy\r\n\tIHRoZSBsYXp5IGRvZw==\r\n\t",
+		"CR":          "VGhlIHF1aWNrIGJyb3du&#13;IGZveCBqdW1wcyBvdmVy&#xD;IHRoZSBsYXp5IGRvZw==",
+		"mixed":       "\r\n    VGhlIHF1aWNrIGJyb3du\n\t\tIGZveCBqdW1wcyBvdmVy\r\n  \t IHRoZSBsYXp5IGRvZw\n",
+		"single line": "VGhlIHF1aWNrIGJyb3duIGZveCBqdW1wcyBvdmVyIHRoZSBsYXp5IGRvZw==",
+	} {
+		document := "<plist version=\"1.0\">\r\n<dict>\r\n\t<key>blob</key>\r\n\t<data>" + text + "</data>\r\n</dict>\r\n</plist>\r\n"
+		decoder := plist.NewDecoder(strings.NewReader(document))
+		decoder.MaxDataBytes = len(expected)
+		value, err := decoder.Decode()
+		if err != nil {
+			t.Errorf("%s: Decode failed: %s", name, err)
+			continue
+		}
+		if data, ok := value.Dict()["blob"].Value.([]byte); !ok || !bytes.Equal(data, expected) {
+			t.Errorf("%s: unexpected data %q", name, value.Dict()["blob"].Value)
+		}
+	}
+}
+
+func TestReadLenientData(t *testing.T) {
+	expected := []byte{0xfb, 0xff, 0xbf, 0x01}
+	for _, text := range []string{"+/+/AQ==", "-_-_AQ==", "-_-_AQ", " -_-_\n AQ", "+/+/.AQ==", "-_-_*AQ"} {
+		document := "<plist><data>" + text + "</data></plist>"
+		decoder := plist.NewDecoder(strings.NewReader(document))
+		decoder.LenientData = true
+		if value, err := decoder.Decode(); err != nil || !bytes.Equal(value.Value.([]byte), expected) {
+			t.Errorf("unexpected result %v, %v for %q", value.Value, err, text)
+		}
+	}
+
+	const document = "<plist><array><string>first</string><data>AAAA-_-_AQ==</data></array></plist>"
+	_, err := plist.Read(strings.NewReader(document))
+	offset := strconv.Itoa(strings.Index(document, "</data>") + len("</data>"))
+	if err == nil || !strings.Contains(err.Error(), "line: "+offset+":") || !strings.Contains(err.Error(), `"AAAA-_-_AQ=="`) {
+		t.Errorf("expected an error with offset and snippet, got %v", err)
+	}
+	var corrupt base64.CorruptInputError
+	if !errors.As(err, &corrupt) || corrupt != 4 {
+		t.Errorf("expected a base64.CorruptInputError at 4, got %v", err)
+	}
+	decoder := plist.NewDecoder(strings.NewReader(`<plist><data>AAAA*A*</data></plist>`))
+	decoder.LenientData = true
+	if _, err := decoder.Decode(); err == nil || !strings.Contains(err.Error(), `"AAAA*A*"`) {
+		t.Errorf("expected an error for invalid lenient data, got %v", err)
+	}
+}
+
+func TestReadByteOrderMark(t *testing.T) {
+	for _, document := range []string{
+		"\xEF\xBB\xBF<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n<plist version=\"1.0\"><string>bom</string></plist>",
+		"\xEF\xBB\xBF<plist><string>bom</string></plist>",
+	} {
+		if value := mustRead(t, document); value.Value != "bom" {
+			t.Errorf("unexpected value %v", value)
+		}
+		if err := plist.Validate(strings.NewReader(document)); err != nil {
+			t.Errorf("Validate failed: %s", err)
+		}
+	}
+	if _, err := plist.ParseString("<plist>\xEF\xBB\xBF<true/></plist>"); err != nil {
+		t.Errorf("unexpected error for a byte order mark in the document: %s", err)
+	}
+}
+
+func TestReadCDATA(t *testing.T) {
+	const document = `<plist><dict>
+		<key>plain</key><string><![CDATA[<b>bold</b> & more]]></string>
+		<key>mixed</key><string>a &amp; <![CDATA[<b>]]> c&#x9;<![CDATA[d]]></string>
+		<key>split</key><string><![CDATA[x]]]]><![CDATA[>y]]></string>
+		<key>empty</key><string><![CDATA[]]></string>
+		<key>lines</key><string><![CDATA[one
+two]]></string>
+		<key><![CDATA[<key>]]> &amp; more</key><integer>1</integer>
+	</dict></plist>`
+	value := mustRead(t, document)
+	expected := map[string]interface{}{
+		"plain":        "<b>bold</b> & more",
+		"mixed":        "a & <b> c\td",
+		"split":        "x]]>y",
+		"empty":        "",
+		"lines":        "one\ntwo",
+		"<key> & more": int64(1),
+	}
+	if !value.EqualRaw(expected) {
+		t.Errorf("unexpected value %q", value.Raw())
+	}
+	if err := plist.Validate(strings.NewReader(document)); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+}
+
+func TestReadDataPadding(t *testing.T) {
+	for _, text := range []string{"aGVsbG8=", "aGVsbG8", "aGVsbG8==", " aGVs bG8\t", "aGVs\n\tbG8\n"} {
+		value := mustRead(t, "<plist><data>"+text+"</data></plist>")
+		if data, ok := value.Value.([]byte); !ok || string(data) != "hello" {
+			t.Errorf("unexpected value %#v for %q", value.Value, text)
+		}
+	}
+	if _, err := plist.Read(strings.NewReader(`<plist><data>aGVsbG8*</data></plist>`)); err == nil {
+		t.Errorf("expected an error for an invalid character")
+	}
+
+	decoder := plist.NewDecoder(strings.NewReader(`<plist><data>AAECAwQ</data></plist>`))
+	decoder.MaxDataBytes = 4
+	if _, err := decoder.Decode(); err == nil {
+		t.Errorf("expected an error for unpadded data exceeding the limit")
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	documents := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict><key>n</key><integer>1</integer></dict>
+</plist>
+
+  <?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><array><integer>2</integer></array></plist><?xml version="1.0"?><plist version="1.0"><string>3</string></plist>
+`
+	values, err := plist.ReadAll(strings.NewReader(documents))
+	if err != nil {
+		t.Fatalf("ReadAll failed: %s", err)
+	}
+	if len(values) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(values))
+	}
+	if !values[0].EqualRaw(map[string]interface{}{"n": 1}) ||
+		!values[1].EqualRaw([]interface{}{2}) ||
+		!values[2].EqualRaw("3") {
+		t.Errorf("unexpected documents %v %v %v", values[0].Raw(), values[1].Raw(), values[2].Raw())
+	}
+}
+
+func TestReadAllEmpty(t *testing.T) {
+	values, err := plist.ReadAll(strings.NewReader("  \n"))
+	if err != nil || len(values) != 0 {
+		t.Errorf("unexpected result %v, %v", values, err)
+	}
+}
+
+func TestDecoderBufferedReader(t *testing.T) {
+	const trailer = "\nframe 2 follows"
+	for _, document := range []string{
+		`<plist><dict><key>a</key><true/></dict></plist>`,
+		"\xef\xbb\xbf<?xml version=\"1.0\"?><plist><string>bom</string></plist>",
+	} {
+		reader := bufio.NewReader(strings.NewReader(document + trailer))
+		if _, err := plist.NewDecoder(reader).Decode(); err != nil {
+			t.Fatal(err)
+		}
+		if rest, _ := io.ReadAll(reader); string(rest) != trailer {
+			t.Errorf("unexpected rest %q after %q", rest, document)
+		}
+	}
+}
+
+func TestReadAllError(t *testing.T) {
+	values, err := plist.ReadAll(strings.NewReader(`<plist><true/></plist><plist><integer>x</integer></plist>`))
+	if err == nil || len(values) != 1 {
+		t.Errorf("expected the first document and an error, got %v, %v", values, err)
+	}
+}
+
+func TestReadExtraRootValue(t *testing.T) {
+	if _, err := plist.Read(strings.NewReader(`<plist><true/><false/></plist>`)); err == nil {
+		t.Errorf("expected an error for a second root value")
+	}
+}
+
+func TestReadKeyWithElement(t *testing.T) {
+	for _, document := range []string{
+		`<plist><dict><key><dict/></key><string>x</string></dict></plist>`,
+		`<plist><dict><key>a<string>b</string></key><true/></dict></plist>`,
+	} {
+		if _, err := plist.Read(strings.NewReader(document)); err == nil {
+			t.Errorf("expected an error for %s", document)
+		} else if !strings.HasPrefix(err.Error(), "PList error") {
+			t.Errorf("expected a plist error for %s, got %s", document, err)
+		}
+	}
+}
+
+func TestReadEmptyContainers(t *testing.T) {
+	value := mustRead(t, `<plist><array><dict></dict><array></array><dict/><array/><string></string><data/></array></plist>`)
+	expected := []interface{}{
+		map[string]interface{}{}, []interface{}{},
+		map[string]interface{}{}, []interface{}{},
+		"", []byte{},
+	}
+	if !value.EqualRaw(expected) {
+		t.Errorf("unexpected value %v", value.Raw())
+	}
+}
+
+func TestReadScalarRoots(t *testing.T) {
+	for document, expected := range map[string]interface{}{
+		`<plist version="1.0"><string>hello</string></plist>`:              "hello",
+		`<plist version="1.0"><string/></plist>`:                           "",
+		`<plist version="1.0"><integer>-42</integer></plist>`:              int64(-42),
+		`<plist version="1.0"><real>2.5</real></plist>`:                    2.5,
+		`<plist version="1.0"><true/></plist>`:                             true,
+		`<plist version="1.0"><false/></plist>`:                            false,
+		`<plist version="1.0"><data>AAEC</data></plist>`:                   []byte{0, 1, 2},
+		`<plist version="1.0"><date>2016-11-01T08:46:41Z</date></plist>`:   time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC),
+		"<plist version=\"1.0\">\n  <string>indented</string>\n</plist>\n": "indented",
+	} {
+		value, err := plist.Read(strings.NewReader(document))
+		if err != nil {
+			t.Errorf("Read failed for %s: %s", document, err)
+		} else if !value.EqualRaw(expected) {
+			t.Errorf("unexpected value %v for %s", value.Raw(), document)
+		}
+		if err := plist.Validate(strings.NewReader(document)); err != nil {
+			t.Errorf("Validate failed for %s: %s", document, err)
+		}
+	}
+}
+
+func TestWriteScalarRoots(t *testing.T) {
+	for _, value := range []plist.Value{
+		{Value: "hello", Type: plist.StringType},
+		{Value: int64(7), Type: plist.IntegerType},
+		{Value: 0.5, Type: plist.RealType},
+		{Value: true, Type: plist.BooleanType},
+		{Value: []byte("data"), Type: plist.DataType},
+		{Value: time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC), Type: plist.DateType},
+	} {
+		var buffer bytes.Buffer
+		if err := value.Write(&buffer); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+		if reread := mustRead(t, buffer.String()); !reread.Equal(value) {
+			t.Errorf("unexpected round trip result %v for %v", reread.Raw(), value.Raw())
+		}
+	}
+}
+
+func TestValuePredicates(t *testing.T) {
+	value := mustRead(t, `<plist><dict><key>a</key><array><string>s</string></array></dict></plist>`)
+	array := value.Value.(map[string]plist.Value)["a"]
+	scalar := array.Value.([]plist.Value)[0]
+	if !value.IsDict() || value.IsArray() || value.IsScalar() || !value.IsValid() {
+		t.Errorf("unexpected predicates for a dict")
+	}
+	if !array.IsArray() || array.IsDict() || array.IsScalar() {
+		t.Errorf("unexpected predicates for an array")
+	}
+	if !scalar.IsScalar() || scalar.IsDict() || scalar.IsArray() {
+		t.Errorf("unexpected predicates for a string")
+	}
+	if plist.InvalidValue.IsValid() || plist.InvalidValue.IsScalar() {
+		t.Errorf("unexpected predicates for InvalidValue")
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	const document = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>list</key><array><string>value</string><data>AAEC</data></array></dict></plist>`
+	for n := len(`<?xml version="1.0" encoding="UTF-8"?>`) + 2; n < len(document)-len("</plist>"); n++ {
+		_, err := plist.Read(strings.NewReader(document[:n]))
+		if !errors.Is(err, plist.ErrTruncated) {
+			t.Errorf("expected ErrTruncated for %q, got %v", document[n-10:n], err)
+		}
+		if err := plist.Validate(strings.NewReader(document[:n])); !errors.Is(err, plist.ErrTruncated) {
+			t.Errorf("expected ErrTruncated from Validate for %q, got %v", document[n-10:n], err)
+		}
+	}
+	for _, malformed := range []string{
+		`<plist><integer>x</integer></plist>`,
+		`<plist><dict><key>a</key></array></dict></plist>`,
+	} {
+		if _, err := plist.Read(strings.NewReader(malformed)); err == nil || errors.Is(err, plist.ErrTruncated) {
+			t.Errorf("expected a non-truncation error for %s, got %v", malformed, err)
+		}
+	}
+}
+
+func TestDecoderKeyTransform(t *testing.T) {
+	const document = `<plist><dict>
+		<key>Name</key><string>first</string>
+		<key>Nested</key><dict><key>ID</key><integer>1</integer></dict>
+		<key>name</key><string>second</string>
+	</dict></plist>`
+	decoder := plist.NewDecoder(strings.NewReader(document))
+	decoder.KeyTransform = strings.ToLower
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if !value.EqualRaw(map[string]interface{}{"name": "second", "nested": map[string]interface{}{"id": 1}}) {
+		t.Errorf("unexpected value %v", value.Raw())
+	}
+
+	decoder = plist.NewDecoder(strings.NewReader(document))
+	decoder.KeyTransform = strings.ToLower
+	decoder.KeyCollisions = plist.RejectDuplicateKeys
+	_, err = decoder.Decode()
+	var duplicate *plist.DuplicateKeyError
+	if !errors.As(err, &duplicate) || duplicate.Key != "name" || duplicate.Path != "" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	decoder = plist.NewDecoder(strings.NewReader(`<plist><dict><key>a</key><true/><key>a</key><false/></dict></plist>`))
+	decoder.KeyTransform = strings.ToLower
+	decoder.KeyCollisions = plist.RejectDuplicateKeys
+	if value, err := decoder.Decode(); err != nil || !value.EqualRaw(map[string]interface{}{"a": false}) {
+		t.Errorf("literal duplicates are no collision, got %v, %v", value.Raw(), err)
+	}
+}
+
+func TestDecoderBooleanPaths(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(`<plist><dict>
+	<key>Enabled</key><integer>1</integer>
+	<key>Count</key><integer>1</integer>
+	<key>Flags</key><array><integer>0</integer><integer>2</integer><true/></array>
+	</dict></plist>`))
+	decoder.BooleanPaths = []string{"Enabled", "Flags.0", "Flags.1", "Flags.2"}
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	expected := map[string]interface{}{
+		"Enabled": true,
+		"Count":   int64(1),
+		"Flags":   []interface{}{false, int64(2), true},
+	}
+	if !value.EqualRaw(expected) {
+		t.Errorf("unexpected value %v", value.Raw())
+	}
+}
+
+func TestParseString(t *testing.T) {
+	const document = `<plist version="1.0"><dict><key>a</key><string>b</string></dict></plist>`
+	value, err := plist.ParseString(document)
+	if err != nil {
+		t.Fatalf("ParseString failed: %s", err)
+	}
+	if parsed, err := plist.Parse([]byte(document)); err != nil || !parsed.Equal(value) {
+		t.Errorf("Parse differs: %v, %v", parsed.Raw(), err)
+	}
+	text, err := value.XMLString()
+	if err != nil {
+		t.Fatalf("XMLString failed: %s", err)
+	}
+	if data, _ := value.Bytes(); text != string(data) {
+		t.Errorf("XMLString differs from Bytes:\n%s", text)
+	}
+	if reread, err := plist.ParseString(text); err != nil || !reread.Equal(value) {
+		t.Errorf("unexpected round trip result %v, %v", reread.Raw(), err)
+	}
+	if _, err := plist.ParseString("<plist><dict>"); err == nil {
+		t.Errorf("expected an error for a truncated document")
+	}
+}
+
+func TestReadDateLayouts(t *testing.T) {
+	expected := time.Date(2016, 11, 1, 8, 46, 41, 0, time.UTC)
+	for text, offset := range map[string]int{
+		"2016-11-01T08:46:41Z":      0,
+		"2016-11-01T09:46:41+01:00": 3600,
+		"2016-11-01T08:46:41+0000":  0,
+		"2016-11-01T10:16:41+0130":  5400,
+		"2016-11-01 08:46:41 +0000": 0,
+		"2016-11-01 03:46:41 -0500": -5 * 3600,
+	} {
+		value := mustRead(t, "<plist><date>"+text+"</date></plist>")
+		date, ok := value.Value.(time.Time)
+		if !ok || !date.Equal(expected) {
+			t.Errorf("unexpected value %v for %q", value.Value, text)
+		} else if _, zoneOffset := date.Zone(); zoneOffset != offset {
+			t.Errorf("unexpected offset %d for %q", zoneOffset, text)
+		}
+	}
+	value := mustRead(t, "<plist><date>2016-11-01T08:46:41.123Z</date></plist>")
+	if date := value.Value.(time.Time); !date.Equal(expected.Add(123 * time.Millisecond)) {
+		t.Errorf("unexpected value %v for fractional seconds", date)
+	}
+
+	_, err := plist.Read(strings.NewReader(`<plist><date>2016-11-01 08:46</date></plist>`))
+	if err == nil || !strings.Contains(err.Error(), `"2006-01-02 15:04:05 -0700"`) {
+		t.Errorf("expected an error listing the layouts, got %v", err)
+	}
+	decoder := plist.NewDecoder(strings.NewReader(`<plist><date>2016-11-01 08:46:41 +0000</date></plist>`))
+	decoder.StrictDates = true
+	if _, err := decoder.Decode(); err == nil || strings.Contains(err.Error(), "-0700") {
+		t.Errorf("expected an error listing RFC 3339 only, got %v", err)
+	}
+}
+
+func TestReadLenientDates(t *testing.T) {
+	for text, expected := range map[string]string{
+		"2016-11-01":             "2016-11-01T00:00:00Z",
+		"2016-11-01T08:46Z":      "2016-11-01T08:46:00Z",
+		"2016-11-01T09:46+01:00": "2016-11-01T09:46:00+01:00",
+	} {
+		document := "<plist><date>" + text + "</date></plist>"
+		if _, err := plist.Read(strings.NewReader(document)); err == nil {
+			t.Errorf("expected an error for %q by default", text)
+		}
+		decoder := plist.NewDecoder(strings.NewReader(document))
+		decoder.LenientDates = true
+		value, err := decoder.Decode()
+		if err != nil {
+			t.Errorf("unexpected error %v for %q", err, text)
+			continue
+		}
+		out := encodeString(t, func(e *plist.Encoder) { e.DateZone = plist.PreserveDates }, value)
+		if !strings.Contains(out, "<date>"+expected+"</date>") {
+			t.Errorf("unexpected output for %q:\n%s", text, out)
+		}
+	}
+
+	decoder := plist.NewDecoder(strings.NewReader("<plist><date>2016-11-01</date></plist>"))
+	decoder.LenientDates = true
+	decoder.StrictDates = true
+	if _, err := decoder.Decode(); err == nil {
+		t.Errorf("expected StrictDates to take precedence")
+	}
+}
+
+func TestDecoderDuplicateKeys(t *testing.T) {
+	const document = `<plist><dict>
+	<key>b</key><integer>0</integer>
+	<key>a</key><integer>1</integer>
+	<key>a</key><integer>2</integer>
+	<key>a</key><integer>3</integer>
+	</dict></plist>`
+	for _, test := range []struct {
+		policy   plist.DuplicateKeyPolicy
+		expected int
+	}{{plist.LastKeyWins, 3}, {plist.FirstKeyWins, 1}} {
+		for _, ordered := range []bool{false, true} {
+			decoder := plist.NewDecoder(strings.NewReader(document))
+			decoder.DuplicateKeys = test.policy
+			decoder.OrderedDicts = ordered
+			value, err := decoder.Decode()
+			if err != nil || !value.EqualRaw(map[string]interface{}{"a": test.expected, "b": 0}) {
+				t.Errorf("unexpected result %v, %v for policy %d", value.Raw(), err, test.policy)
+			}
+			if ordered {
+				if keys := value.Value.(*plist.OrderedDict).Keys; len(keys) != 2 || keys[0] != "b" || keys[1] != "a" {
+					t.Errorf("unexpected key order %v", keys)
+				}
+			}
+		}
+	}
+
+	decoder := plist.NewDecoder(strings.NewReader(document))
+	decoder.DuplicateKeys = plist.RejectDuplicateKeys
+	_, err := decoder.Decode()
+	var duplicate *plist.DuplicateKeyError
+	// The offset is the end of the second key.
+	offset := strings.Index(document, "<key>a</key><integer>2") + len("<key>a</key>")
+	if !errors.As(err, &duplicate) || duplicate.Key != "a" || !strings.Contains(err.Error(), "line: "+strconv.Itoa(offset)+":") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReadKeyWithoutValue(t *testing.T) {
+	for _, test := range []struct{ document, key string }{
+		{`<plist><dict><key>Name</key></dict></plist>`, "Name"},
+		{`<plist><dict><key>a</key><true/><key>Last</key>
+		</dict></plist>`, "Last"},
+		{`<plist><array><dict><key>Nested</key></dict><string>sibling</string></array></plist>`, "Nested"},
+		{`<plist><dict><key>Middle</key><key>b</key><true/></dict></plist>`, "Middle"},
+	} {
+		_, err := plist.Read(strings.NewReader(test.document))
+		if err == nil || !strings.HasPrefix(err.Error(), "PList error line") || !strings.Contains(err.Error(), `Key "`+test.key+`" has no value`) {
+			t.Errorf("unexpected error %v for %s", err, test.document)
+		}
+	}
+	if _, err := plist.Read(strings.NewReader(`<plist version="1.0"></plist>`)); err == nil || !strings.Contains(err.Error(), "Plist element has no value") {
+		t.Errorf("unexpected error %v for an empty plist", err)
+	}
+}
+
+const commentedDocument = `<?xml version="1.0"?>
+<!-- before the plist -->
+<plist version="1.0">
+<!-- before the root -->
+<dict>
+	<!-- Shown to users -->
+	<key>Name</key>
+	<!-- between key and value -->
+	<string>a<!-- inside text -->b</string>
+	<key>Items</key>
+	<array>
+		<!-- first -->
+		<integer>1</integer>
+		<integer>2</integer>
+		<!-- trailing in array -->
+	</array>
+	<!-- trailing in dict -->
+</dict>
+<!-- after the root -->
+</plist>
+<!-- after the plist -->`
+
+func TestReadComments(t *testing.T) {
+	value := mustRead(t, commentedDocument)
+	expected := mustRead(t, `<plist><dict><key>Name</key><string>ab</string><key>Items</key><array><integer>1</integer><integer>2</integer></array></dict></plist>`)
+	if !value.Equal(expected) {
+		t.Errorf("unexpected value %v", value.Raw())
+	}
+
+	decoder := plist.NewDecoder(strings.NewReader(commentedDocument))
+	decoder.KeepComments = true
+	if _, err := decoder.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	metadata := decoder.Metadata()
+	for path, text := range map[string]string{
+		"":        "before the root",
+		"Name":    "Shown to users\nbetween key and value",
+		"Items.0": "first",
+	} {
+		if comment, ok := metadata.Comment(path); !ok || comment != text {
+			t.Errorf("unexpected comment %q, %v at %q", comment, ok, path)
+		}
+	}
+	for _, path := range []string{"Items", "Items.1"} {
+		if comment, ok := metadata.Comment(path); ok {
+			t.Errorf("unexpected comment %q at %q", comment, path)
+		}
+	}
+	for path, text := range map[string]string{"": "trailing in dict", "Items": "trailing in array"} {
+		if comment, ok := metadata.TrailingComment(path); !ok || comment != text {
+			t.Errorf("unexpected trailing comment %q, %v at %q", comment, ok, path)
+		}
+	}
+}
+
+func TestReadRealEdgeCases(t *testing.T) {
+	for text, bits := range map[string]uint64{
+		"-0":                      0x8000000000000000,
+		"-0.0":                    0x8000000000000000,
+		"0.0":                     0,
+		"5e-324":                  1,
+		"4.9406564584124654e-324": 1,
+		"-5e-324":                 0x8000000000000001,
+		"2.225073858507201e-308":  0x000fffffffffffff,
+		"2.2250738585072014e-308": 0x0010000000000000,
+		"1e-400":                  0,
+	} {
+		value := mustRead(t, "<plist><real>"+text+"</real></plist>")
+		if got := math.Float64bits(value.Value.(float64)); got != bits {
+			t.Errorf("%s read as %#x, expected %#x", text, got, bits)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// maxPooledBytes limits the buffers kept in the pool, so a single large
+// document does not pin its memory.
+const maxPooledBytes = 64 << 10
+
+// pooledEncoder holds the Encoder and buffers used by Value.Write, WriteTo and
+// Bytes, which are reused across calls through encoderPool.
+type pooledEncoder struct {
+	encoder Encoder
+	counter countingWriter
+	buffer  bytes.Buffer
+}
+
+var encoderPool = sync.Pool{New: func() interface{} { return new(pooledEncoder) }}
+
+func getEncoder() *pooledEncoder {
+	return encoderPool.Get().(*pooledEncoder)
+}
+
+func (self *pooledEncoder) encode(ctx context.Context, value Value, writer io.Writer) error {
+	self.encoder.Reset(writer)
+	return self.encoder.EncodeContext(ctx, value)
+}
+
+// release drops all references to the caller's writer and values and returns
+// the encoder to the pool.
+func (self *pooledEncoder) release() {
+	self.encoder.Reset(nil)
+	if writer := self.encoder.xmlWriter; writer != nil {
+		writer.writer.Reset(nil)
+		writer.release()
+	}
+	self.counter = countingWriter{}
+	if self.buffer.Cap() > maxPooledBytes {
+		self.buffer = bytes.Buffer{}
+	}
+	self.buffer.Reset()
+	encoderPool.Put(self)
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SortArray sorts the elements of an array value in place using less, or
+// ScalarLess when less is nil. The sort is stable. An error is returned if the
+// value is not an array.
+func (self Value) SortArray(less func(a, b Value) bool) error {
+	if self.Type != ArrayType {
+		return fmt.Errorf("SortArray on %s value", self.Type.Name())
+	}
+	if less == nil {
+		less = ScalarLess
+	}
+	values := self.Value.([]Value)
+	sort.SliceStable(values, func(i, j int) bool {
+		return less(values[i], values[j])
+	})
+	return nil
+}
+
+// ScalarLess orders scalars of the same kind: strings lexically, integers and
+// reals numerically, dates chronologically, false before true, data bytewise
+// and UIDs numerically. Values of different kinds, dicts and arrays are ordered by their
+// ValueType.
+func ScalarLess(a, b Value) bool {
+	if fa, ok := a.number(); ok {
+		if fb, ok := b.number(); ok {
+			return fa < fb
+		}
+	}
+	if a.Type != b.Type {
+		return a.Type < b.Type
+	}
+	switch a.Type {
+	case StringType:
+		return a.Value.(string) < b.Value.(string)
+	case DateType:
+		return a.Value.(time.Time).Before(b.Value.(time.Time))
+	case BooleanType:
+		return !a.Value.(bool) && b.Value.(bool)
+	case DataType:
+		return bytes.Compare(a.data(), b.data()) < 0
+	case UIDType:
+		return a.Value.(UID) < b.Value.(UID)
+	}
+	return false
+}
+
+// number returns integers and reals as float64.
+func (self Value) number() (float64, bool) {
+	switch self.Type {
+	case IntegerType:
+		if i, u, large := self.integer(); large {
+			return float64(u), true
+		} else {
+			return float64(i), true
+		}
+	case RealType:
+		return self.Value.(float64), true
+	}
+	return 0, false
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestSortArray(t *testing.T) {
+	value := mustRead(t, `<plist><array>
+		<string>b</string><integer>3</integer><string>a</string>
+		<real>2.5</real><true/><integer>-1</integer><false/>
+	</array></plist>`)
+	if err := value.SortArray(nil); err != nil {
+		t.Fatalf("SortArray failed: %s", err)
+	}
+	expected := []interface{}{"a", "b", -1, 2.5, 3, false, true}
+	if !value.EqualRaw(expected) {
+		t.Errorf("unexpected order %v", value.Raw())
+	}
+
+	if err := value.SortArray(func(a, b plist.Value) bool { return plist.ScalarLess(b, a) }); err != nil {
+		t.Fatalf("SortArray failed: %s", err)
+	}
+	if first := value.Value.([]plist.Value)[0]; first.Value != true {
+		t.Errorf("unexpected first element %v", first.Value)
+	}
+}
+
+func TestSortArrayCustom(t *testing.T) {
+	value := mustRead(t, `<plist><array><string>b</string><string>A</string><string>c</string></array></plist>`)
+	value.SortArray(func(a, b plist.Value) bool {
+		return strings.ToLower(a.Value.(string)) < strings.ToLower(b.Value.(string))
+	})
+	if !value.EqualRaw([]interface{}{"A", "b", "c"}) {
+		t.Errorf("unexpected order %v", value.Raw())
+	}
+}
+
+func TestSortArrayNotArray(t *testing.T) {
+	if err := mustRead(t, `<plist><dict/></plist>`).SortArray(nil); err == nil {
+		t.Errorf("expected an error for a dict")
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+	"strconv"
+)
+
+// encoderStream tracks the open containers of a document written with the
+// streaming methods of Encoder.
+type encoderStream struct {
+	writer *xmlWriter
+	frames []streamFrame
+	// done is set once the root value is complete.
+	done bool
+}
+
+type streamFrame struct {
+	name string
+	// opened is set once the start tag is written. Containers closed before
+	// that are written as empty-element tags.
+	opened bool
+	// key is set between a key and the value of a dict entry.
+	key bool
+	// count is the number of elements of an array.
+	count int
+}
+
+func (self *encoderStream) top() *streamFrame {
+	if len(self.frames) == 0 {
+		return nil
+	}
+	return &self.frames[len(self.frames)-1]
+}
+
+// checkValue returns an error if no value may follow, otherwise the key path
+// of the next value.
+func (self *encoderStream) checkValue() ([]string, error) {
+	frame := self.top()
+	switch {
+	case frame == nil && self.done:
+		return nil, fmt.Errorf("Value after the root value")
+	case frame == nil:
+		return nil, nil
+	case frame.name == "dict" && !frame.key:
+		return nil, fmt.Errorf("Value without a key in dict")
+	case frame.name == "array":
+		return append(self.writer.path[:len(self.writer.path):len(self.writer.path)], strconv.Itoa(frame.count)), nil
+	}
+	return self.writer.path, nil
+}
+
+// beginValue opens the parent container and pushes the path of the next
+// value, which checkValue accepted.
+func (self *encoderStream) beginValue() {
+	frame := self.top()
+	if frame == nil {
+		return
+	}
+	self.open()
+	if frame.name == "dict" {
+		// The key pushed the path already.
+		frame.key = false
+	} else {
+		self.writer.path = append(self.writer.path, strconv.Itoa(frame.count))
+		self.writer.comment(self.writer.path)
+		frame.count++
+	}
+}
+
+// endValue pops the path of a completed value.
+func (self *encoderStream) endValue() {
+	if len(self.frames) == 0 {
+		self.done = true
+		return
+	}
+	self.writer.path = self.writer.path[:len(self.writer.path)-1]
+}
+
+// open writes the pending start tag of the innermost container.
+func (self *encoderStream) open() {
+	if frame := self.top(); frame != nil && !frame.opened {
+		frame.opened = true
+		self.writer.newline()
+		self.writer.startTag(frame.name, false)
+		self.writer.depth++
+	}
+}
+
+func (self *Encoder) startStream() (*encoderStream, error) {
+	if self.stream == nil {
+		if err := self.validate(); err != nil {
+			return nil, err
+		}
+		self.stream = &encoderStream{writer: self.startDocument()}
+	}
+	return self.stream, nil
+}
+
+func (self *Encoder) begin(name string) error {
+	stream, err := self.startStream()
+	if err != nil {
+		return err
+	}
+	if _, err := stream.checkValue(); err != nil {
+		return err
+	}
+	stream.beginValue()
+	if !self.Canonical {
+		stream.writer.attributes = self.Metadata.Attributes(joinPath(stream.writer.path))
+	}
+	stream.frames = append(stream.frames, streamFrame{name: name})
+	return stream.writer.err
+}
+
+func (self *Encoder) end(name string) error {
+	stream := self.stream
+	if stream == nil || stream.top() == nil || stream.top().name != name {
+		return fmt.Errorf("No open %s to end", name)
+	}
+	frame := stream.top()
+	if frame.key {
+		return fmt.Errorf("Key without a value in dict")
+	}
+	if text, ok := stream.writer.trailingComment(); ok {
+		stream.open()
+		stream.writer.writeComment(text)
+	}
+	stream.frames = stream.frames[:len(stream.frames)-1]
+	if frame.opened {
+		stream.writer.depth--
+		stream.writer.newline()
+		stream.writer.endTag(name)
+	} else {
+		stream.writer.emptyElement(name)
+	}
+	stream.endValue()
+	return stream.writer.err
+}
+
+// BeginDict starts a dict as the next value of a streamed document. Streamed
+// documents are written incrementally: the document is started by the first
+// BeginDict, BeginArray or Scalar call, entries of a dict are written by Key
+// followed by a value, and Finish completes the document. Calls which would
+// produce an invalid document return an error without writing anything.
+func (self *Encoder) BeginDict() error {
+	return self.begin("dict")
+}
+
+// EndDict ends the innermost open dict.
+func (self *Encoder) EndDict() error {
+	return self.end("dict")
+}
+
+// BeginArray starts an array as the next value of a streamed document.
+func (self *Encoder) BeginArray() error {
+	return self.begin("array")
+}
+
+// EndArray ends the innermost open array.
+func (self *Encoder) EndArray() error {
+	return self.end("array")
+}
+
+// Key writes the key of the next entry of the innermost open dict.
+func (self *Encoder) Key(key string) error {
+	stream := self.stream
+	if stream == nil || stream.top() == nil || stream.top().name != "dict" {
+		return fmt.Errorf("Key %q outside of a dict", key)
+	}
+	frame := stream.top()
+	if frame.key {
+		return fmt.Errorf("Key %q follows a key without a value", key)
+	}
+	path := append(stream.writer.path[:len(stream.writer.path):len(stream.writer.path)], key)
+	if r, ok := invalidChar(key); ok && self.InvalidChars == RejectInvalidChars {
+		return &InvalidCharError{Path: joinPath(path), Key: true, Char: r}
+	}
+	stream.open()
+	stream.writer.comment(path)
+	stream.writer.element("key", self.cleanText(key))
+	frame.key = true
+	stream.writer.path = path
+	return stream.writer.err
+}
+
+// Scalar writes a scalar value as the next value of a streamed document.
+func (self *Encoder) Scalar(value Value) error {
+	if !value.IsScalar() {
+		return fmt.Errorf("Scalar called with a %s value", value.Type.Name())
+	}
+	return self.streamValue(value)
+}
+
+// streamValue writes value as the next value of a streamed document.
+func (self *Encoder) streamValue(value Value) error {
+	stream, err := self.startStream()
+	if err != nil {
+		return err
+	}
+	path, err := stream.checkValue()
+	if err != nil {
+		return err
+	}
+	if err := self.checkValue(value, path); err != nil {
+		return err
+	}
+	stream.beginValue()
+	if err := stream.writer.writeValue(value); err != nil {
+		return err
+	}
+	stream.endValue()
+	return nil
+}
+
+// Finish completes a streamed document and flushes it to the output. It
+// returns an error if a dict or array is still open. The Encoder can write
+// further documents afterwards.
+func (self *Encoder) Finish() error {
+	stream := self.stream
+	if stream == nil {
+		return fmt.Errorf("Finish without a streamed document")
+	}
+	if frame := stream.top(); frame != nil {
+		return fmt.Errorf("Finish with %d open containers, innermost %s", len(stream.frames), frame.name)
+	}
+	self.stream = nil
+	return self.endDocument(stream.writer)
+}
+
+// EncodeArrayFrom writes a document holding an array of the values produced
+// by seq, writing each element as soon as it is produced. If seq yields an
+// error, or a value cannot be encoded, the output written so far is flushed
+// without the closing tags, so readers detect the incomplete document, and
+// the error is returned.
+func (self *Encoder) EncodeArrayFrom(seq iter.Seq2[Value, error]) error {
+	if self.stream != nil {
+		return fmt.Errorf("EncodeArrayFrom while a streamed document is unfinished")
+	}
+	if err := self.BeginArray(); err != nil {
+		return err
+	}
+	for value, err := range seq {
+		if err == nil {
+			err = self.streamValue(value)
+		}
+		if err != nil {
+			self.abort()
+			return err
+		}
+	}
+	if err := self.EndArray(); err != nil {
+		self.abort()
+		return err
+	}
+	return self.Finish()
+}
+
+// EncodeArrayFromAny is EncodeArrayFrom for Go values, which are converted as
+// Marshal does. Nil pointers, interfaces, slices and maps are left out of the
+// array, values which cannot be marshaled abort the document.
+func (self *Encoder) EncodeArrayFromAny(seq iter.Seq2[interface{}, error]) error {
+	return self.EncodeArrayFrom(func(yield func(Value, error) bool) {
+		index := 0
+		for v, err := range seq {
+			value, ok := InvalidValue, false
+			if err == nil {
+				value, ok, err = marshal(reflect.ValueOf(v), []string{strconv.Itoa(index)})
+			}
+			if err == nil && !ok {
+				continue
+			}
+			if !yield(value, err) {
+				return
+			}
+			index++
+		}
+	})
+}
+
+// abort flushes the output of an unfinished streamed document and discards
+// its state.
+func (self *Encoder) abort() {
+	if self.stream != nil {
+		self.stream.writer.writer.Flush()
+		self.stream = nil
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestEncoderStream(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	encoder.HexIntegers = []string{"devices.1.mask"}
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+	}
+	check(encoder.BeginDict())
+	check(encoder.Key("devices"))
+	check(encoder.BeginArray())
+	for i := int64(0); i < 2; i++ {
+		check(encoder.BeginDict())
+		check(encoder.Key("id"))
+		check(encoder.Scalar(plist.Value{Value: i, Type: plist.IntegerType}))
+		check(encoder.Key("mask"))
+		check(encoder.Scalar(plist.Value{Value: int64(255), Type: plist.IntegerType}))
+		check(encoder.Key("tags"))
+		check(encoder.BeginArray())
+		check(encoder.EndArray())
+		check(encoder.EndDict())
+	}
+	check(encoder.EndArray())
+	check(encoder.Key("empty"))
+	check(encoder.BeginDict())
+	check(encoder.EndDict())
+	check(encoder.EndDict())
+	check(encoder.Finish())
+
+	device := func(i int64) plist.Value {
+		return plist.Value{Value: map[string]plist.Value{
+			"id":   {Value: i, Type: plist.IntegerType},
+			"mask": {Value: int64(255), Type: plist.IntegerType},
+			"tags": {Value: []plist.Value{}, Type: plist.ArrayType},
+		}, Type: plist.DictType}
+	}
+	expected := encodeString(t, func(e *plist.Encoder) { e.HexIntegers = []string{"devices.1.mask"} }, plist.Value{Value: map[string]plist.Value{
+		"devices": {Value: []plist.Value{device(0), device(1)}, Type: plist.ArrayType},
+		"empty":   {Value: map[string]plist.Value{}, Type: plist.DictType},
+	}, Type: plist.DictType})
+	if buffer.String() != expected {
+		t.Errorf("streamed document differs from Encode:\n%s\n%s", buffer.String(), expected)
+	}
+
+	buffer.Reset()
+	check(encoder.Scalar(plist.Value{Value: "root", Type: plist.StringType}))
+	check(encoder.Finish())
+	if mustRead(t, buffer.String()).Value != "root" {
+		t.Errorf("unexpected scalar document %s", buffer.String())
+	}
+}
+
+func TestEncoderStreamMisuse(t *testing.T) {
+	value := plist.Value{Value: "x", Type: plist.StringType}
+	for name, misuse := range map[string]func(*plist.Encoder) error{
+		"key outside dict": func(e *plist.Encoder) error { return e.Key("a") },
+		"key in array": func(e *plist.Encoder) error {
+			e.BeginArray()
+			return e.Key("a")
+		},
+		"value without key": func(e *plist.Encoder) error {
+			e.BeginDict()
+			return e.Scalar(value)
+		},
+		"two keys": func(e *plist.Encoder) error {
+			e.BeginDict()
+			e.Key("a")
+			return e.Key("b")
+		},
+		"end with pending key": func(e *plist.Encoder) error {
+			e.BeginDict()
+			e.Key("a")
+			return e.EndDict()
+		},
+		"mismatched end": func(e *plist.Encoder) error {
+			e.BeginDict()
+			return e.EndArray()
+		},
+		"second root": func(e *plist.Encoder) error {
+			e.Scalar(value)
+			return e.Scalar(value)
+		},
+		"unclosed": func(e *plist.Encoder) error {
+			e.BeginArray()
+			return e.Finish()
+		},
+		"container as scalar": func(e *plist.Encoder) error {
+			return e.Scalar(plist.Value{Value: []plist.Value{}, Type: plist.ArrayType})
+		},
+		"finish without document": func(e *plist.Encoder) error { return e.Finish() },
+	} {
+		if err := misuse(plist.NewEncoder(&bytes.Buffer{})); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestEncodeArrayFrom(t *testing.T) {
+	records := func(n int, fail error) iter.Seq2[plist.Value, error] {
+		return func(yield func(plist.Value, error) bool) {
+			for i := 0; i < n; i++ {
+				if !yield(appendRecord(int64(i)), nil) {
+					return
+				}
+			}
+			if fail != nil {
+				yield(plist.InvalidValue, fail)
+			}
+		}
+	}
+	var buffer bytes.Buffer
+	if err := plist.NewEncoder(&buffer).EncodeArrayFrom(records(3, nil)); err != nil {
+		t.Fatalf("EncodeArrayFrom failed: %s", err)
+	}
+	expected := encodeString(t, nil, plist.Value{Value: []plist.Value{appendRecord(0), appendRecord(1), appendRecord(2)}, Type: plist.ArrayType})
+	if buffer.String() != expected {
+		t.Errorf("unexpected document:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	failure := errors.New("cursor failed")
+	encoder := plist.NewEncoder(&buffer)
+	if err := encoder.EncodeArrayFrom(records(2, failure)); err != failure {
+		t.Errorf("expected the producer error, got %v", err)
+	}
+	if strings.Contains(buffer.String(), "</plist>") || !strings.Contains(buffer.String(), "<integer>1</integer>") {
+		t.Errorf("unexpected aborted document:\n%s", buffer.String())
+	}
+	if _, err := plist.Read(&buffer); err == nil {
+		t.Errorf("expected the aborted document to be unreadable")
+	}
+	if err := encoder.EncodeArrayFrom(records(0, nil)); err != nil {
+		t.Errorf("Encoder unusable after an abort: %s", err)
+	}
+}
+
+func TestEncodeArrayFromAny(t *testing.T) {
+	type record struct {
+		Name  string
+		Count int
+	}
+	seq := func(values ...interface{}) iter.Seq2[interface{}, error] {
+		return func(yield func(interface{}, error) bool) {
+			for _, v := range values {
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}
+	}
+	var buffer bytes.Buffer
+	if err := plist.NewEncoder(&buffer).EncodeArrayFromAny(seq(record{"a", 1}, (*record)(nil), &record{"b", 2})); err != nil {
+		t.Fatalf("EncodeArrayFromAny failed: %s", err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"Name": "a", "Count": int64(1)},
+		map[string]interface{}{"Name": "b", "Count": int64(2)},
+	}
+	if value, err := plist.Read(&buffer); err != nil || !value.EqualRaw(expected) {
+		t.Errorf("unexpected result %v, %v", value, err)
+	}
+
+	buffer.Reset()
+	err := plist.NewEncoder(&buffer).EncodeArrayFromAny(seq("a", make(chan int)))
+	if err == nil || !strings.Contains(err.Error(), `"1"`) || strings.Contains(buffer.String(), "</plist>") {
+		t.Errorf("expected an error for a channel, got %v:\n%s", err, buffer.String())
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import "strconv"
+
+// uidKey is the key of the dict representing a UID in XML plists.
+const uidKey = "CF$UID"
+
+// UID is an object reference of an NSKeyedArchiver plist. In XML it is
+// written as a dict holding the single integer entry CF$UID.
+type UID uint64
+
+// collapseUID turns a dict holding only a non-negative CF$UID integer into a
+// UIDType value.
+func collapseUID(value Value) Value {
+	if value.Type != DictType {
+		return value
+	}
+	m := value.dictMap()
+	if len(m) != 1 || m[uidKey].Type != IntegerType {
+		return value
+	}
+	if i, u, large := m[uidKey].integer(); large {
+		return Value{UID(u), UIDType}
+	} else if i >= 0 {
+		return Value{UID(i), UIDType}
+	}
+	return value
+}
+
+// writeUID writes the dict form of a UID.
+func (self *xmlWriter) writeUID(uid UID) {
+	self.newline()
+	self.startTag("dict", false)
+	self.depth++
+	self.element("key", uidKey)
+	self.element("integer", strconv.FormatUint(uint64(uid), 10))
+	self.depth--
+	self.newline()
+	self.write("</dict>")
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+const archiveDocument = `<plist version="1.0"><dict>
+	<key>$archiver</key><string>NSKeyedArchiver</string>
+	<key>$top</key><dict><key>root</key><dict><key>CF$UID</key><integer>1</integer></dict></dict>
+	<key>$objects</key><array>
+		<string>$null</string>
+		<dict><key>CF$UID</key><integer>-1</integer></dict>
+		<dict><key>CF$UID</key><integer>2</integer><key>other</key><true/></dict>
+	</array>
+</dict></plist>`
+
+func TestDecodeUIDs(t *testing.T) {
+	decoder := plist.NewDecoder(strings.NewReader(archiveDocument))
+	decoder.DecodeUIDs = true
+	value, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	m := value.Value.(map[string]plist.Value)
+	root := m["$top"].Value.(map[string]plist.Value)["root"]
+	if root.Type != plist.UIDType || root.Value != plist.UID(1) {
+		t.Errorf("unexpected root reference %v", root)
+	}
+	for _, object := range m["$objects"].Value.([]plist.Value)[1:] {
+		if object.Type != plist.DictType {
+			t.Errorf("expected a dict for %v", object.Raw())
+		}
+	}
+	if plain := mustRead(t, archiveDocument); plain.Equal(value) {
+		t.Errorf("UIDs must only be decoded with DecodeUIDs")
+	}
+
+	out := encodeString(t, nil, value)
+	if !strings.Contains(stripIndentation(out), "<dict>\n<key>CF$UID</key>\n<integer>1</integer>\n</dict>") {
+		t.Errorf("unexpected UID form:\n%s", out)
+	}
+	decoder = plist.NewDecoder(strings.NewReader(out))
+	decoder.DecodeUIDs = true
+	if reread, err := decoder.Decode(); err != nil || !reread.Equal(value) {
+		t.Errorf("unexpected round trip result %v, %v", reread.Raw(), err)
+	}
+	if clone := value.Clone(); !clone.Equal(value) || clone.Hash() != value.Hash() {
+		t.Errorf("clone differs from the original")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// URLValues converts a dict of scalars into url.Values. Arrays of scalars
+// become repeated parameters. Scalars are written like Flatten writes them:
+// dates as RFC 3339 in UTC and data as standard base64. Nested dicts and
+// arrays are rejected with an error.
+func (self Value) URLValues() (url.Values, error) {
+	if self.Type != DictType {
+		return nil, fmt.Errorf("URLValues on %s value", self.Type.Name())
+	}
+	result := url.Values{}
+	m := self.dictMap()
+	for _, key := range self.dictKeys() {
+		value := m[key]
+		switch {
+		case value.IsScalar():
+			result.Add(key, value.scalarString())
+		case value.IsArray():
+			for i, element := range value.Value.([]Value) {
+				if !element.IsScalar() {
+					return nil, fmt.Errorf("Unsupported %s value at %q", element.Type.Name(), joinPath([]string{key, strconv.Itoa(i)}))
+				}
+				result.Add(key, element.scalarString())
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported %s value at %q", value.Type.Name(), key)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"testing"
+)
+
+func TestURLValues(t *testing.T) {
+	values, err := mustRead(t, `<plist><dict>
+		<key>name</key><string>a b&amp;c</string>
+		<key>count</key><integer>3</integer>
+		<key>enabled</key><true/>
+		<key>when</key><date>2016-11-01T08:46:41Z</date>
+		<key>blob</key><data>AAEC</data>
+		<key>tag</key><array><string>x</string><real>0.5</real></array>
+	</dict></plist>`).URLValues()
+	if err != nil {
+		t.Fatalf("URLValues failed: %s", err)
+	}
+	expected := "blob=AAEC&count=3&enabled=true&name=a+b%26c&tag=x&tag=0.5&when=2016-11-01T08%3A46%3A41Z"
+	if encoded := values.Encode(); encoded != expected {
+		t.Errorf("unexpected query %s", encoded)
+	}
+
+	for _, document := range []string{
+		`<plist><dict><key>nested</key><dict/></dict></plist>`,
+		`<plist><dict><key>list</key><array><array/></array></dict></plist>`,
+		`<plist><array/></plist>`,
+	} {
+		if _, err := mustRead(t, document).URLValues(); err == nil {
+			t.Errorf("expected an error for %s", document)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Validate checks that reader holds exactly one well-formed plist document:
+// balanced tags, known elements, keys followed by values, scalar contents
+// which parse, a single root value and nesting within DefaultMaxDepth. It
+// returns nil or the first error found together with its offset. Only
+// individual scalars are converted, no Value tree is built.
+func Validate(reader io.Reader) error {
+	decoder := NewDecoder(reader)
+	decoder.init()
+	if err := decoder.readPrologue(); err != nil {
+		if err == io.EOF {
+			return plistErrorFromString(decoder.decoder.InputOffset(), "No plist element found")
+		}
+		return err
+	}
+	if err := decoder.validateValue(); err != nil {
+		return err
+	}
+	if err := decoder.readDocumentEnd(); err != nil {
+		return err
+	}
+	for {
+		token, err := decoder.decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return plistErrorFromError(decoder.decoder.InputOffset(), err)
+		}
+		if element, ok := token.(xml.StartElement); ok {
+			return plistErrorFromError(decoder.decoder.InputOffset(), fmt.Errorf("Unexpected element %s after the plist", element.Name.Local))
+		}
+	}
+}
+
+// nextElement returns the next start element, or nil at an end element.
+func (self *Decoder) nextElement() (*xml.StartElement, error) {
+	for {
+		token, err := self.decoder.Token()
+		if err != nil {
+			return nil, plistErrorFromError(self.decoder.InputOffset(), err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			return &element, nil
+		case xml.EndElement:
+			return nil, nil
+		}
+	}
+}
+
+// elementText returns the text of element, rejecting nested elements.
+func (self *Decoder) elementText(element xml.StartElement) (string, error) {
+	var text []byte
+	for {
+		token, err := self.decoder.Token()
+		if err != nil {
+			return "", plistErrorFromError(self.decoder.InputOffset(), err)
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.StartElement:
+			return "", plistErrorFromError(self.decoder.InputOffset(), fmt.Errorf("Unexpected element %s in %s", t.Name.Local, element.Name.Local))
+		case xml.EndElement:
+			return string(text), nil
+		}
+	}
+}
+
+func (self *Decoder) validateValue() error {
+	element, err := self.nextElement()
+	if err != nil {
+		return err
+	} else if element == nil {
+		return plistErrorFromString(self.decoder.InputOffset(), "Missing value")
+	}
+	return self.validateElement(*element)
+}
+
+func (self *Decoder) validateElement(element xml.StartElement) error {
+	if filter := self.scalarFilter(element.Name.Local); filter != nil {
+		text, err := self.elementText(element)
+		if err != nil {
+			return err
+		}
+		if _, err := filter(text); err != nil {
+			return withOffset(self.decoder.InputOffset(), err)
+		}
+		return nil
+	}
+	switch element.Name.Local {
+	case "true", "false":
+		if text, err := self.elementText(element); err != nil {
+			return err
+		} else if strings.TrimSpace(text) != "" {
+			return plistErrorFromError(self.decoder.InputOffset(), fmt.Errorf("Unexpected text in %s", element.Name.Local))
+		}
+		return nil
+	case "dict":
+		if err := self.enter(); err != nil {
+			return err
+		}
+		defer self.leave()
+		for {
+			key, err := self.nextElement()
+			if err != nil {
+				return err
+			} else if key == nil {
+				return nil
+			} else if key.Name.Local != "key" {
+				return plistErrorFromError(self.decoder.InputOffset(), fmt.Errorf("Expected key, found %s", key.Name.Local))
+			}
+			if _, err := self.elementText(*key); err != nil {
+				return err
+			}
+			if err := self.validateValue(); err != nil {
+				return err
+			}
+		}
+	case "array":
+		if err := self.enter(); err != nil {
+			return err
+		}
+		defer self.leave()
+		for {
+			value, err := self.nextElement()
+			if err != nil {
+				return err
+			} else if value == nil {
+				return nil
+			}
+			if err := self.validateElement(*value); err != nil {
+				return err
+			}
+		}
+	}
+	return plistErrorFromError(self.decoder.InputOffset(), fmt.Errorf("Unsupported element %s", element.Name.Local))
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestValidate(t *testing.T) {
+	for _, document := range []string{
+		orderedDocument,
+		flattenDocument,
+		`<plist version="1.0"><array/></plist>`,
+		`<?xml version="1.0"?><plist version="1.0"><true/></plist>`,
+	} {
+		if err := plist.Validate(strings.NewReader(document)); err != nil {
+			t.Errorf("Validate failed: %s\n%s", err, document)
+		}
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	for _, document := range []string{
+		``,
+		`<plist><dict><key>a</key><string>b</string></plist>`,
+		`<plist><integer>1.5</integer></plist>`,
+		`<plist><real>x</real></plist>`,
+		`<plist><date>yesterday</date></plist>`,
+		`<plist><data>!!!</data></plist>`,
+		`<plist><dict><key>a</key></dict></plist>`,
+		`<plist><dict><string>a</string></dict></plist>`,
+		`<plist><string><b>bold</b></string></plist>`,
+		`<plist><true>yes</true></plist>`,
+		`<plist><set/></plist>`,
+		`<plist><true/><false/></plist>`,
+		`<plist><true/></plist><plist><true/></plist>`,
+		`<plist></plist>`,
+	} {
+		if err := plist.Validate(strings.NewReader(document)); err == nil {
+			t.Errorf("expected an error for %s", document)
+		}
+	}
+}
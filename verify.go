@@ -0,0 +1,105 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// VerifyError reports a document written with WriteOptions.Verify which does
+// not read back equal to the value.
+type VerifyError struct {
+	// Path is the key path of the first difference.
+	Path string
+	// Err is set when the document could not be read at all.
+	Err error
+}
+
+func (self *VerifyError) Error() string {
+	if self.Err != nil {
+		return fmt.Sprintf("Written document cannot be read back: %s", self.Err)
+	}
+	return fmt.Sprintf("Written document differs from the value at %q", self.Path)
+}
+
+func (self *VerifyError) Unwrap() error {
+	return self.Err
+}
+
+// encodeVerified writes the document to a buffer and copies it to the output
+// once it reads back equal to value.
+func (self *Encoder) encodeVerified(ctx context.Context, value Value) error {
+	var buffer bytes.Buffer
+	writer := self.writer
+	self.writer = &buffer
+	err := self.encode(ctx, value)
+	self.writer = writer
+	if err != nil {
+		return err
+	}
+	decoder := NewDecoder(bytes.NewReader(buffer.Bytes()))
+	decoder.DataEncoding = self.dataEncoding()
+	decoder.DecodeUIDs = true
+	reread, err := decoder.Decode()
+	if err != nil {
+		return &VerifyError{Err: err}
+	}
+	if path, ok := firstDifference(value, reread, nil); ok {
+		return &VerifyError{Path: path}
+	}
+	_, err = buffer.WriteTo(writer)
+	return err
+}
+
+// firstDifference returns the key path of the first difference between a and
+// b. Dicts in the form of UIDs compare equal to UIDs.
+func firstDifference(a, b Value, path []string) (string, bool) {
+	a, b = collapseUID(a), collapseUID(b)
+	if a.Type != b.Type {
+		return joinPath(path), true
+	}
+	switch a.Type {
+	case ArrayType:
+		as, bs := a.Value.([]Value), b.Value.([]Value)
+		if len(as) != len(bs) {
+			return joinPath(path), true
+		}
+		for i := range as {
+			if difference, ok := firstDifference(as[i], bs[i], append(path, strconv.Itoa(i))); ok {
+				return difference, true
+			}
+		}
+	case DictType:
+		am, bm := a.dictMap(), b.dictMap()
+		keys := make([]string, 0, len(am)+len(bm))
+		for key := range am {
+			keys = append(keys, key)
+		}
+		for key := range bm {
+			if _, ok := am[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			av, aok := am[key]
+			bv, bok := bm[key]
+			if aok != bok {
+				return joinPath(append(path, key)), true
+			}
+			if difference, ok := firstDifference(av, bv, append(path, key)); ok {
+				return difference, true
+			}
+		}
+	default:
+		if !a.Equal(b) {
+			return joinPath(path), true
+		}
+	}
+	return "", false
+}
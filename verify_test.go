@@ -0,0 +1,48 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vinzenz/go-plist"
+)
+
+func TestEncoderVerify(t *testing.T) {
+	value := plist.NewDictBuilder().
+		String("Name", "a & b").
+		Value("Ref", plist.Value{Value: plist.UID(3), Type: plist.UIDType}).
+		Array("Dates", func(a *plist.ArrayBuilder) {
+			a.Date(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+		}).
+		Build()
+	var buffer bytes.Buffer
+	encoder := plist.NewEncoder(&buffer)
+	encoder.Verify = true
+	if err := encoder.Encode(value); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if buffer.String() != encodeString(t, nil, value) {
+		t.Errorf("verified output differs:\n%s", buffer.String())
+	}
+
+	// Fractional seconds are lost without FractionalSeconds.
+	value.Dict()["Dates"].Array()[0] = plist.Value{Value: time.Date(2016, 1, 2, 3, 4, 5, 500, time.UTC), Type: plist.DateType}
+	buffer.Reset()
+	err := encoder.Encode(value)
+	var verifyError *plist.VerifyError
+	if !errors.As(err, &verifyError) || verifyError.Path != "Dates.0" {
+		t.Errorf("expected a VerifyError at Dates.0, got %v", err)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected no output, got %q", buffer.String())
+	}
+	encoder.FractionalSeconds = true
+	if err := encoder.Encode(value); err != nil {
+		t.Errorf("Encode with FractionalSeconds failed: %s", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Walk calls fn for the value and every value below it in depth-first order
+// with its key path. Dict entries are visited in sorted key order, or in the
+// original order of an *OrderedDict. Walk stops at the first error returned
+// by fn and returns it.
+func (self Value) Walk(fn func(path string, value Value) error) error {
+	return self.walk(nil, fn)
+}
+
+func (self Value) walk(path []string, fn func(string, Value) error) error {
+	if err := fn(joinPath(path), self); err != nil {
+		return err
+	}
+	switch self.Type {
+	case ArrayType:
+		for i, v := range self.Value.([]Value) {
+			if err := v.walk(append(path, strconv.Itoa(i)), fn); err != nil {
+				return err
+			}
+		}
+	case DictType:
+		m := self.dictMap()
+		for _, k := range self.dictKeys() {
+			if err := m[k].walk(append(path, k), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CollectData returns the payloads of all data values in the order of Walk.
+// The slices are shared with the value.
+func (self Value) CollectData() [][]byte {
+	var result [][]byte
+	self.Walk(func(path string, value Value) error {
+		if value.Type == DataType {
+			result = append(result, value.data())
+		}
+		return nil
+	})
+	return result
+}
+
+// CollectStrings returns all string values in the order of Walk. Dict keys
+// are not included.
+func (self Value) CollectStrings() []string {
+	var result []string
+	self.Walk(func(path string, value Value) error {
+		if value.Type == StringType {
+			result = append(result, value.Value.(string))
+		}
+		return nil
+	})
+	return result
+}
+
+// ReplaceStrings returns a copy of the value with all occurrences of old in
+// string values replaced by new. Dict keys are rewritten as well if keys is
+// set; when rewritten keys collide, the entry of the key last in the order of
+// Walk wins. Dicts and arrays are copied, other values are kept.
+func (self Value) ReplaceStrings(old, new string, keys bool) Value {
+	return self.mapStrings(func(s string) string {
+		return strings.ReplaceAll(s, old, new)
+	}, keys)
+}
+
+// ReplaceRegexp is like ReplaceStrings, but replaces the matches of re with
+// repl as regexp.Regexp.ReplaceAllString does.
+func (self Value) ReplaceRegexp(re *regexp.Regexp, repl string, keys bool) Value {
+	return self.mapStrings(func(s string) string {
+		return re.ReplaceAllString(s, repl)
+	}, keys)
+}
+
+func (self Value) mapStrings(fn func(string) string, keys bool) Value {
+	switch self.Type {
+	case ArrayType:
+		values := self.Value.([]Value)
+		result := make([]Value, len(values))
+		for i, v := range values {
+			result[i] = v.mapStrings(fn, keys)
+		}
+		return Value{result, ArrayType}
+	case DictType:
+		m := self.dictMap()
+		result := &OrderedDict{Map: make(map[string]Value, len(m))}
+		for _, k := range self.dictKeys() {
+			key := k
+			if keys {
+				key = fn(k)
+			}
+			result.Set(key, m[k].mapStrings(fn, keys))
+		}
+		if _, ok := self.Value.(*OrderedDict); ok {
+			return Value{result, DictType}
+		}
+		return Value{result.Map, DictType}
+	case StringType:
+		return Value{fn(self.Value.(string)), StringType}
+	}
+	return self
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/go-plist"
+)
+
+const walkDocument = `<plist><dict>
+	<key>b</key><array><string>first</string><data>AAE=</data></array>
+	<key>a</key><dict><key>token</key><string>secret</string><key>blob</key><data>Ag==</data></dict>
+</dict></plist>`
+
+func TestWalk(t *testing.T) {
+	var paths []string
+	mustRead(t, walkDocument).Walk(func(path string, value plist.Value) error {
+		paths = append(paths, path+":"+value.Type.Name())
+		return nil
+	})
+	expected := ":dict,a:dict,a.blob:data,a.token:string,b:array,b.0:string,b.1:data"
+	if strings.Join(paths, ",") != expected {
+		t.Errorf("unexpected walk %v", paths)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err := mustRead(t, walkDocument).Walk(func(path string, value plist.Value) error {
+		if count++; path == "a.blob" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || count != 3 {
+		t.Errorf("unexpected result %v after %d calls", err, count)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	value := mustRead(t, walkDocument)
+	data := value.CollectData()
+	if len(data) != 2 || !bytes.Equal(data[0], []byte{2}) || !bytes.Equal(data[1], []byte{0, 1}) {
+		t.Errorf("unexpected data %v", data)
+	}
+	if s := value.CollectStrings(); strings.Join(s, ",") != "secret,first" {
+		t.Errorf("unexpected strings %v", s)
+	}
+}
+
+func TestReplaceStrings(t *testing.T) {
+	value := mustRead(t, walkDocument)
+	replaced := value.ReplaceStrings("e", "3", false)
+	if s := replaced.CollectStrings(); strings.Join(s, ",") != "s3cr3t,first" {
+		t.Errorf("unexpected strings %v", s)
+	}
+	if s := value.CollectStrings(); strings.Join(s, ",") != "secret,first" {
+		t.Errorf("original modified: %v", s)
+	}
+
+	var paths []string
+	value.ReplaceRegexp(regexp.MustCompile(`^[a-z]+$`), "x$0", true).Walk(func(path string, value plist.Value) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if strings.Join(paths, ",") != ",xa,xa.xblob,xa.xtoken,xb,xb.0,xb.1" {
+		t.Errorf("unexpected paths %v", paths)
+	}
+
+	// Rewritten keys colliding keep the last entry.
+	collide := mustRead(t, `<plist><dict><key>a1</key><integer>1</integer><key>a2</key><integer>2</integer></dict></plist>`)
+	var result []string
+	collide.ReplaceRegexp(regexp.MustCompile(`[0-9]`), "", true).Walk(func(path string, value plist.Value) error {
+		if value.Type == plist.IntegerType {
+			result = append(result, fmt.Sprint(path, "=", value.Value))
+		}
+		return nil
+	})
+	if strings.Join(result, ",") != "a=2" {
+		t.Errorf("unexpected result %v", result)
+	}
+}
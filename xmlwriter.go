@@ -0,0 +1,520 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const indentation = "  "
+
+// newlines holds a line break followed by the indentation of the deepest
+// levels, sliced by newline to avoid building the string for every element.
+var newlines = "\n" + strings.Repeat(indentation, 32)
+
+// formatReal returns the shortest text which parses back to exactly f,
+// including the sign of negative zero. Exponents are used for very large and
+// small magnitudes, so "-2.0e+04" is written as "-20000" or, with
+// RealDecimalPoint, as "-20000.0". NaN and infinities
+// use the spellings CFPropertyList accepts.
+func (self *WriteOptions) formatReal(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "+infinity"
+	case math.IsInf(f, -1):
+		return "-infinity"
+	}
+	if self.Canonical {
+		return canonicalReal(f)
+	}
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	if self.RealDecimalPoint && !strings.Contains(text, ".") {
+		if i := strings.IndexByte(text, 'e'); i >= 0 {
+			return text[:i] + ".0" + text[i:]
+		}
+		return text + ".0"
+	}
+	return text
+}
+
+func (self *WriteOptions) dataEncoding() *base64.Encoding {
+	if self.DataEncoding == nil || self.Canonical {
+		return base64.StdEncoding
+	}
+	return self.DataEncoding
+}
+
+func (self *WriteOptions) formatDate(t time.Time) string {
+	switch {
+	case self.Canonical || self.DateZone == UTCDates:
+		t = t.UTC()
+	case self.DateZone == LocalDates:
+		t = t.Local()
+	}
+	if self.FractionalSeconds || self.Canonical {
+		return t.Format(time.RFC3339Nano)
+	}
+	// UTC dates end in Z, the format written by CoreFoundation.
+	return t.Format(time.RFC3339)
+}
+
+// xmlWriter writes the plist XML grammar directly instead of going through
+// xml.Encoder, which cannot produce empty-element tags like <true/>.
+// The first write error is kept and all following writes are skipped.
+type xmlWriter struct {
+	writer  *bufio.Writer
+	options *WriteOptions
+	depth   int
+	err     error
+	// path holds the key path segments of the value being written.
+	path []string
+	// hexPaths holds the paths of WriteOptions.HexIntegers.
+	hexPaths map[string]bool
+	// attributes are written into the next start tag.
+	attributes []xml.Attr
+	// scratch holds the base64 text of data values.
+	scratch []byte
+	// ascii escapes all non-ASCII characters, see WriteOptions.ASCIIOnly.
+	ascii bool
+	// ctx is the context of the document, its Done channel done is checked
+	// before each element.
+	ctx  context.Context
+	done <-chan struct{}
+	// lineStart is set while nothing was written on the first line, so the
+	// next newline only indents.
+	lineStart bool
+}
+
+func newXmlWriter(writer *bufio.Writer, options *WriteOptions) *xmlWriter {
+	result := &xmlWriter{writer: writer}
+	result.reset(options)
+	return result
+}
+
+// reset prepares the writer for a new document written with options, keeping
+// its buffers.
+func (self *xmlWriter) reset(options *WriteOptions) {
+	self.options = options
+	self.depth = 0
+	self.err = nil
+	self.path = self.path[:0]
+	self.attributes = nil
+	self.lineStart = false
+	self.ctx, self.done = nil, nil
+	self.ascii = options.ASCIIOnly || isASCIICharset(declaredEncoding(options.xmlDeclaration()))
+	self.hexPaths = nil
+	if len(options.HexIntegers) > 0 {
+		self.hexPaths = make(map[string]bool, len(options.HexIntegers))
+		for _, path := range options.HexIntegers {
+			self.hexPaths[path] = true
+		}
+	}
+}
+
+// release clears the references to the written value kept in the buffers of
+// the writer before it is pooled.
+func (self *xmlWriter) release() {
+	clear(self.path[:cap(self.path)])
+	self.path = self.path[:0]
+	self.attributes = nil
+	self.hexPaths = nil
+	self.ctx, self.done = nil, nil
+	if cap(self.scratch) > maxPooledBytes {
+		self.scratch = nil
+	}
+}
+
+func (self *xmlWriter) write(s string) {
+	if self.err == nil {
+		_, self.err = self.writer.WriteString(s)
+	}
+}
+
+// writeEncoded writes base64 text. Only the alphabets of the base64 package
+// are known to need no escaping.
+func (self *xmlWriter) writeEncoded(text []byte) {
+	switch self.options.dataEncoding() {
+	case base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding:
+		if self.err == nil {
+			_, self.err = self.writer.Write(text)
+		}
+	default:
+		self.writeText(string(text))
+	}
+}
+
+// writeText writes s escaped like xml.EscapeText escapes it, but without
+// converting s to a byte slice first. Carriage returns, tabs and line feeds
+// are written as character references, so they survive the line end
+// normalization of XML readers, carriage returns as &#13; like Apple does.
+// For ASCII output all non-ASCII characters are written as character
+// references too.
+func (self *xmlWriter) writeText(s string) {
+	last := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c < utf8.RuneSelf && c != '"' && c != '\'' && c != '&' && c != '<' && c != '>' {
+			i++
+			continue
+		}
+		r, width := utf8.DecodeRuneInString(s[i:])
+		var escaped string
+		switch r {
+		case '"':
+			escaped = "&#34;"
+		case '\'':
+			escaped = "&#39;"
+		case '&':
+			escaped = "&amp;"
+		case '<':
+			escaped = "&lt;"
+		case '>':
+			escaped = "&gt;"
+		case '\t':
+			escaped = "&#x9;"
+		case '\n':
+			escaped = "&#xA;"
+		case '\r':
+			escaped = "&#13;"
+		default:
+			if !isXMLChar(r) || !validRune(s[i:], r) {
+				escaped = "\uFFFD"
+			} else if !self.ascii {
+				i += width
+				continue
+			}
+			if self.ascii {
+				escaped = "&#x" + strings.ToUpper(strconv.FormatInt(int64(r), 16)) + ";"
+			}
+		}
+		self.write(s[last:i])
+		self.write(escaped)
+		i += width
+		last = i
+	}
+	self.write(s[last:])
+}
+
+// cdata reports whether s is written as CDATA section, see
+// WriteOptions.CDATAThreshold.
+func (self *xmlWriter) cdata(s string) bool {
+	if self.options.CDATAThreshold == 0 || self.options.Canonical {
+		return false
+	}
+	escaped := 0
+	for i, r := range s {
+		switch {
+		case r == '<' || r == '>' || r == '&' || r == '"' || r == '\'' || r == '\t' || r == '\n':
+			escaped++
+		case r == '\r' || !isXMLChar(r) || !validRune(s[i:], r) || self.ascii && r >= utf8.RuneSelf:
+			return false
+		}
+	}
+	return float64(escaped) >= self.options.CDATAThreshold*float64(len(s))
+}
+
+// writeCDATA writes s as CDATA section, splitting it at each "]]>".
+func (self *xmlWriter) writeCDATA(s string) {
+	self.write("<![CDATA[")
+	self.write(strings.ReplaceAll(s, "]]>", "]]]]><![CDATA[>"))
+	self.write("]]>")
+}
+
+// newline starts a new line indented to the current depth, or only indents
+// the first line of a fragment. Compact output has no line breaks, unless it
+// is canonical.
+func (self *xmlWriter) newline() {
+	if self.options.Compact && !self.options.Canonical {
+		return
+	}
+	start := 0
+	if self.lineStart {
+		start, self.lineStart = 1, false
+	}
+	if n := 1 + self.depth*len(indentation); n <= len(newlines) {
+		self.write(newlines[start:n])
+		return
+	}
+	self.write("\n"[start:])
+	for i := 0; i < self.depth; i++ {
+		self.write(indentation)
+	}
+}
+
+// startTag writes the start tag or, if empty is set, the empty-element tag of
+// name carrying the pending attributes.
+func (self *xmlWriter) startTag(name string, empty bool) {
+	self.write("<")
+	self.write(name)
+	for _, attr := range self.attributes {
+		self.write(" ")
+		self.write(attr.Name.Local)
+		self.write(`="`)
+		self.writeText(attr.Value)
+		self.write(`"`)
+	}
+	self.attributes = nil
+	if empty {
+		self.write("/>")
+	} else {
+		self.write(">")
+	}
+}
+
+func (self *xmlWriter) element(name, text string) {
+	self.newline()
+	self.startTag(name, false)
+	self.writeText(text)
+	self.endTag(name)
+}
+
+func (self *xmlWriter) endTag(name string) {
+	self.write("</")
+	self.write(name)
+	self.write(">")
+}
+
+// comment writes the comment of WriteOptions.Comments, or else the one
+// recorded in the Metadata, for the value at path on a line of its own.
+func (self *xmlWriter) comment(path []string) {
+	if self.options.Canonical || len(self.options.Comments) == 0 && self.options.Metadata == nil {
+		return
+	}
+	text, ok := self.options.Comments[joinPath(path)]
+	if !ok {
+		text, ok = self.options.Metadata.Comment(joinPath(path))
+		ok = ok && self.writableComment(text)
+	}
+	if ok {
+		self.writeComment(text)
+	}
+}
+
+// trailingComment returns the comment recorded in the Metadata after the
+// last entry or element of the dict or array at the current path.
+func (self *xmlWriter) trailingComment() (string, bool) {
+	if self.options.Canonical {
+		return "", false
+	}
+	text, ok := self.options.Metadata.TrailingComment(joinPath(self.path))
+	return text, ok && self.writableComment(text)
+}
+
+// writableComment reports whether a recorded comment can be written, which
+// is not the case for non-ASCII comments in ASCII output.
+func (self *xmlWriter) writableComment(text string) bool {
+	return !self.ascii || strings.IndexFunc(text, func(r rune) bool { return r > unicode.MaxASCII }) < 0
+}
+
+// writeComment writes text as a comment on a line of its own. Further lines
+// of text start at the depth of the comment, or are joined by spaces in
+// compact output.
+func (self *xmlWriter) writeComment(text string) {
+	self.newline()
+	self.write("<!-- ")
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			if self.options.Compact {
+				self.write(" ")
+			} else {
+				self.newline()
+			}
+			line = strings.TrimLeft(line, " \t")
+		}
+		self.write(line)
+	}
+	self.write(" -->")
+}
+
+func (self *xmlWriter) emptyElement(name string) {
+	self.newline()
+	self.startTag(name, true)
+}
+
+// numberText returns the original text of a number recorded in the Metadata.
+func (self *xmlWriter) numberText(value Value) (string, bool) {
+	if self.options.Metadata == nil || self.options.Canonical {
+		return "", false
+	}
+	return self.options.Metadata.numberText(joinPath(self.path), value)
+}
+
+// formatInteger writes value in hexadecimal when requested by IntegerBase or
+// HexIntegers for the current path. Negative integers and canonical output
+// are always decimal, values above math.MaxInt64 are written unsigned.
+func (self *xmlWriter) formatInteger(value Value) string {
+	if i, _, _ := value.integer(); i >= 0 && !self.options.Canonical && (self.options.IntegerBase == 16 || self.hexPaths != nil && self.hexPaths[joinPath(self.path)]) {
+		return "0x" + strings.ToUpper(value.formatInteger(16))
+	}
+	return value.formatInteger(10)
+}
+
+// formatScalar returns the text of an integer, real or date without Format
+// hooks.
+func (self *xmlWriter) formatScalar(value Value) string {
+	switch value.Type {
+	case IntegerType:
+		return self.formatInteger(value)
+	case RealType:
+		return self.options.formatReal(value.Value.(float64))
+	}
+	return self.options.formatDate(value.Value.(time.Time))
+}
+
+// data writes a data element, wrapping the base64 text to lines of
+// DataWrapWidth characters at the depth of the element.
+func (self *xmlWriter) data(data []byte) {
+	self.scratch = self.options.dataEncoding().AppendEncode(self.scratch[:0], data)
+	self.encodedData(len(data) == 0)
+}
+
+// encodedData writes a data element holding the base64 text in scratch, or
+// an empty-element tag if empty is set.
+func (self *xmlWriter) encodedData(empty bool) {
+	width := self.options.DataWrapWidth
+	if empty {
+		self.emptyElement("data")
+		return
+	}
+	text := self.scratch
+	if width <= 0 || self.options.Compact || self.options.Canonical || len(text) <= width {
+		self.newline()
+		self.startTag("data", false)
+		self.writeEncoded(text)
+		self.endTag("data")
+		return
+	}
+	self.newline()
+	self.startTag("data", false)
+	for len(text) > 0 {
+		n := width
+		if n > len(text) {
+			n = len(text)
+		}
+		self.newline()
+		self.writeEncoded(text[:n])
+		text = text[n:]
+	}
+	self.newline()
+	self.write("</data>")
+}
+
+// writeValue writes value as element on a new line at the current depth.
+// Empty dicts, arrays, strings and data use empty-element tags like Apple's
+// tools write them.
+func (self *xmlWriter) writeValue(value Value) error {
+	select {
+	case <-self.done:
+		return self.ctx.Err()
+	default:
+	}
+	if self.err != nil {
+		return self.err
+	}
+	options := self.options
+	if options.Metadata != nil && !options.Canonical {
+		self.attributes = options.Metadata.Attributes(joinPath(self.path))
+	}
+	switch value.Type {
+	case ArrayType:
+		values := value.Value.([]Value)
+		trailing, hasTrailing := self.trailingComment()
+		if len(values) == 0 && !hasTrailing {
+			self.emptyElement("array")
+			break
+		}
+		self.newline()
+		self.startTag("array", false)
+		self.depth++
+		for i, v := range values {
+			self.path = append(self.path, strconv.Itoa(i))
+			self.comment(self.path)
+			if err := self.writeValue(v); err != nil {
+				return err
+			}
+			self.path = self.path[:len(self.path)-1]
+		}
+		if hasTrailing {
+			self.writeComment(trailing)
+		}
+		self.depth--
+		self.newline()
+		self.write("</array>")
+	case DictType:
+		m := value.dictMap()
+		trailing, hasTrailing := self.trailingComment()
+		if len(m) == 0 && !hasTrailing {
+			self.emptyElement("dict")
+			break
+		}
+		self.newline()
+		self.startTag("dict", false)
+		self.depth++
+		for _, k := range options.orderKeys(joinPath(self.path), options.dictKeys(value)) {
+			self.path = append(self.path, k)
+			self.comment(self.path)
+			self.element("key", options.cleanText(k))
+			if err := self.writeValue(m[k]); err != nil {
+				return err
+			}
+			self.path = self.path[:len(self.path)-1]
+		}
+		if hasTrailing {
+			self.writeComment(trailing)
+		}
+		self.depth--
+		self.newline()
+		self.write("</dict>")
+	case NullType:
+		self.emptyElement("string")
+	case StringType:
+		if s := options.cleanText(value.Value.(string)); s == "" {
+			self.emptyElement("string")
+		} else if self.cdata(s) {
+			self.newline()
+			self.startTag("string", false)
+			self.writeCDATA(s)
+			self.endTag("string")
+		} else {
+			self.element("string", s)
+		}
+	case IntegerType, RealType, DateType:
+		if text, ok := self.numberText(value); ok {
+			self.element(value.Type.Name(), text)
+		} else if text, ok := options.hookText(value); ok {
+			self.element(value.Type.Name(), text)
+		} else {
+			self.element(value.Type.Name(), self.formatScalar(value))
+		}
+	case DataType:
+		if lazy, ok := value.Value.(*lazyData); ok && lazy.encoding == options.dataEncoding() {
+			self.scratch = append(self.scratch[:0], lazy.text...)
+			self.encodedData(len(lazy.text) == 0)
+		} else {
+			self.data(value.data())
+		}
+	case BooleanType:
+		if value.Value.(bool) {
+			self.emptyElement("true")
+		} else {
+			self.emptyElement("false")
+		}
+	case UIDType:
+		self.writeUID(value.Value.(UID))
+	default:
+		return InvalidTypeError
+	}
+	return self.err
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Vinzenz Feenstra. All rights reserved.
+// Use of this source code is governed by a BSD-2-clause
+// license that can be found in the LICENSE file.
+package plist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func escapeText(s string) string {
+	var buffer bytes.Buffer
+	writer := newXmlWriter(bufio.NewWriter(&buffer), &WriteOptions{})
+	writer.writeText(s)
+	writer.writer.Flush()
+	return buffer.String()
+}
+
+// referenceEscapeText escapes s with xml.EscapeText, spelling carriage
+// returns like the writer does.
+func referenceEscapeText(s string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(s))
+	return strings.ReplaceAll(buffer.String(), "&#xD;", "&#13;")
+}
+
+func TestWriteTextMatchesEncodingXML(t *testing.T) {
+	for _, s := range []string{
+		"", "plain", `<a href="x">'&'</a>`, "tab\tnew\nline\rreturn",
+		"\x00\x08\x1f", "Üsér Diacriticà", "\xff\xfe invalid", "\uFFFD\uFFFF", "emoji \U0001F600",
+	} {
+		if got, expected := escapeText(s), referenceEscapeText(s); got != expected {
+			t.Errorf("escaped %q as %q, expected %q", s, got, expected)
+		}
+	}
+	if err := quick.CheckEqual(escapeText, referenceEscapeText, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+var benchmarkText = strings.Repeat("Keys should be sorted case-insensitive & <escaped> ", 20)
+
+func BenchmarkWriteText(b *testing.B) {
+	writer := newXmlWriter(bufio.NewWriter(io.Discard), &WriteOptions{})
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkText)))
+	for i := 0; i < b.N; i++ {
+		writer.writeText(benchmarkText)
+	}
+}
+
+// BenchmarkWriteTextEncodingXML measures the escaping previously used by the
+// writer for comparison.
+func BenchmarkWriteTextEncodingXML(b *testing.B) {
+	writer := bufio.NewWriter(io.Discard)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkText)))
+	for i := 0; i < b.N; i++ {
+		xml.EscapeText(writer, []byte(benchmarkText))
+	}
+}
+
+func BenchmarkWriteLarge(b *testing.B) {
+	records := make([]Value, 1000)
+	for i := range records {
+		records[i] = Value{map[string]Value{
+			"name":  {"device & <host>", StringType},
+			"id":    {int64(i), IntegerType},
+			"ratio": {float64(i) / 7, RealType},
+			"blob":  {[]byte("0123456789abcdef"), DataType},
+		}, DictType}
+	}
+	value := Value{records, ArrayType}
+	counter := &countingWriter{writer: io.Discard}
+	value.Write(counter)
+	b.SetBytes(counter.n)
+	b.ReportAllocs()
+	encoder := NewEncoder(io.Discard)
+	for i := 0; i < b.N; i++ {
+		if err := encoder.Encode(value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}